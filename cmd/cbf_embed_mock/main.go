@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"cbf2go/internal/embed/mock"
+)
+
+func main() {
+	var host string
+	var port int
+	var noBatch bool
+	cfg := mock.DefaultConfig()
+	flag.StringVar(&host, "host", "0.0.0.0", "host to listen on")
+	flag.IntVar(&port, "port", 8888, "port to listen on")
+	flag.IntVar(&cfg.Dim, "dim", cfg.Dim, "embedding dimension")
+	flag.DurationVar(&cfg.Latency, "latency", cfg.Latency, "delay of every response, e.g. 100ms")
+	flag.DurationVar(&cfg.Jitter, "jitter", cfg.Jitter, "random extra delay up to this value")
+	flag.Float64Var(&cfg.ErrorRate, "error-rate", cfg.ErrorRate, "probability of injected failure")
+	flag.IntVar(&cfg.ErrorStatus, "error-status", cfg.ErrorStatus, "HTTP status of injected failures")
+	flag.IntVar(&cfg.FailFirst, "fail-first", cfg.FailFirst, "number of first embedding requests which fail")
+	flag.BoolVar(&noBatch, "no-batch", false, "disable binary batch protocol")
+	flag.IntVar(&cfg.MaxBatch, "max-batch", cfg.MaxBatch, "maximum batch size announced to clients")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of latency jitter and failure injection")
+	flag.Parse()
+	cfg.Batch = !noBatch
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	log.Printf("mock embedding service on %s with config %+v", addr, cfg)
+	log.Fatal(http.ListenAndServe(addr, mock.NewHandler(cfg)))
+}
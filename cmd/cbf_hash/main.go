@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/walk"
+)
+
+// FileHash represents content fingerprints of a CBF file
+type FileHash struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	PHash  string `json:"phash"`
+	hash   uint64
+}
+
+// Duplicate represents pair of identical or similar files
+type Duplicate struct {
+	File     string `json:"file"`
+	Other    string `json:"other"`
+	Distance int    `json:"distance"` // Hamming distance of perceptual hashes
+	Exact    bool   `json:"exact"`    // files have identical binary section
+}
+
+func main() {
+	var fin, format, fext string
+	var distance, verbose int
+	flag.StringVar(&fin, "fin", "", "CBF file or directory with CBF files")
+	flag.StringVar(&format, "format", "table", "output format: table or json")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use for directories")
+	flag.IntVar(&distance, "distance", cbf.NearDuplicateDistance, "maximum Hamming distance of perceptual hashes of near-duplicates, negative value disables duplicate search")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file or directory is provided")
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+
+	var hashes []FileHash
+	for _, fname := range files {
+		frame, err := cbf.ReadFrame(fname, verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", fname, err)
+			continue
+		}
+		h := cbf.PerceptualHash(frame, nil)
+		hashes = append(hashes, FileHash{
+			File:   fname,
+			SHA256: cbf.ContentHash(frame),
+			PHash:  cbf.FormatHash(h),
+			hash:   h,
+		})
+	}
+
+	var dups []Duplicate
+	if distance >= 0 {
+		for i := range hashes {
+			for j := i + 1; j < len(hashes); j++ {
+				d := cbf.HammingDistance(hashes[i].hash, hashes[j].hash)
+				exact := hashes[i].SHA256 == hashes[j].SHA256
+				if exact || d <= distance {
+					dups = append(dups, Duplicate{File: hashes[i].File, Other: hashes[j].File, Distance: d, Exact: exact})
+				}
+			}
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"files": hashes, "duplicates": dups}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	for _, h := range hashes {
+		fmt.Printf("%s  %s  %s\n", h.SHA256, h.PHash, h.File)
+	}
+	for _, d := range dups {
+		kind := "near-duplicate"
+		if d.Exact {
+			kind = "duplicate"
+		}
+		fmt.Printf("%s: %s %s (distance %d)\n", kind, d.File, d.Other, d.Distance)
+	}
+}
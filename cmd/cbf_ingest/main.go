@@ -1,32 +1,190 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
 
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
 	"cbf2go/internal/qdrant"
+	"cbf2go/internal/walk"
 )
 
 func main() {
-	var file, qurl, qcol, fext, eurl string
-	var size, verbose, nworkers, timeoutLimit int
+	var file, qurl, qcol, fext, eurl, method, projection, cacheDir, clipURL, clipCol, maskFile, background, identity, include, exclude, symlinks, manifest, onError, errorReport string
+	var size, verbose, nworkers, timeoutLimit, retries, cacheSize int
+	var skipDuplicates, skipNearDuplicates, gzip, recursive, hidden, resume bool
+	var maxDepth, nearDistance int
+	var fileTimeout time.Duration
+	upsert := qdrant.DefaultUpsertParams()
+	policy := qdrant.DefaultErrorPolicy()
 	flag.StringVar(&file, "file", "", "CBF file path")
 	flag.StringVar(&qurl, "url", "localhost:6334", "Qdrant URL")
 	flag.StringVar(&qcol, "collection", "cbf_images", "CBF collection name")
 	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use")
+	flag.BoolVar(&recursive, "recursive", false, "ingest files of subdirectories")
+	flag.IntVar(&maxDepth, "max-depth", 0, "maximum depth of subdirectories of recursive ingestion, 0 means no limit")
+	flag.StringVar(&include, "include", "", "comma separated glob patterns of ingested files, e.g. '*.cbf,**/sweep_*/*.cbf' (default *.<file-extension>)")
+	flag.StringVar(&exclude, "exclude", "", "comma separated glob patterns of excluded files and directories")
+	flag.StringVar(&symlinks, "symlinks", string(walk.SymlinkFiles), "symbolic links policy: skip, files (follow links to files) or follow")
+	flag.BoolVar(&hidden, "hidden", false, "ingest hidden files and directories")
 	flag.StringVar(&eurl, "embed-url", "", "URL of embedding service")
+	flag.StringVar(&clipURL, "clip-url", "", "URL of CLIP service, if set CLIP embeddings are added to CLIP collection")
+	flag.StringVar(&clipCol, "clip-collection", "", "CLIP collection name (default <collection>_clip)")
+	flag.StringVar(&method, "method", "", fmt.Sprintf("embedding method: %s, parameters may follow after colon, e.g. image2embedding-v2:asinh,p1-99.5 (default method of existing collection, for new collections resnet if embed-url is set, otherwise %s)", strings.Join(embed.Methods(), ", "), embed.DefaultMethod))
+	flag.StringVar(&projection, "projection", "", "projection file created by cbf_projection to reduce embedding vectors")
+	flag.StringVar(&cacheDir, "embed-cache", "", "directory of embedding cache, empty value disables the cache")
+	flag.IntVar(&cacheSize, "embed-cache-size", 1024, "maximum size of embedding cache in MB")
+	flag.StringVar(&maskFile, "mask", "", "mask PNG file with shadowed pixels to exclude")
+	flag.StringVar(&background, "background", "none", "background to subtract before embedding: none, radial, median or rollingball")
+	flag.StringVar(&identity, "identity", string(qdrant.DefaultIdentity), "point identity key: content, path or path+mtime, re-ingested frames with the same identity overwrite their points")
+	flag.StringVar(&manifest, "manifest", "", "manifest file which records outcome of every ingested file")
+	flag.BoolVar(&resume, "resume", false, "resume ingestion recorded in manifest, completed files are skipped and failed ones are retried")
+	flag.StringVar(&onError, "on-error", "continue", "error policy: continue ingests remaining files, fail-fast stops on the first failed file")
+	flag.IntVar(&policy.MaxErrors, "max-errors", 0, "stop after given number of failed files, 0 means no limit")
+	flag.Float64Var(&policy.MaxErrorRate, "max-error-rate", 0, "stop when fraction of failed files exceeds given rate, 0 means no limit")
+	flag.IntVar(&policy.MinFiles, "max-error-rate-files", policy.MinFiles, "number of processed files before error rate is checked")
+	flag.StringVar(&errorReport, "error-report", "", "file of failed files report, CSV if file has .csv extension and JSON otherwise")
 	flag.IntVar(&size, "embed-size", 512, "embedding vector size")
+	flag.IntVar(&retries, "embed-retries", embed.DefaultRetryPolicy().MaxRetries, "number of retries of failed requests to embedding service")
 	flag.IntVar(&verbose, "verbose", 0, "verbosity level")
-	flag.IntVar(&timeoutLimit, "timeout-limit", 60, "timeout limit buffer for batch ingestion")
+	flag.IntVar(&timeoutLimit, "timeout-limit", 60, "timeout limit buffer for batch ingestion, the whole batch is limited to this number of seconds plus one second per file and worker")
+	flag.DurationVar(&fileTimeout, "file-timeout", 0, "timeout of single file ingestion, e.g. 30s, 0 means no limit")
 	flag.IntVar(&nworkers, "nworkers", 10, "number of workers for batch submission")
+	flag.IntVar(&upsert.BatchSize, "upsert-batch", upsert.BatchSize, "number of points per Qdrant upsert request, 0 upserts every point separately")
+	flag.DurationVar(&upsert.FlushInterval, "upsert-interval", upsert.FlushInterval, "maximum time points are buffered before upsert")
+	flag.IntVar(&upsert.Checkpoint, "upsert-checkpoint", upsert.Checkpoint, "wait until points are applied every N upsert batches, 0 waits at the end only")
+	flag.IntVar(&upsert.MaxInFlight, "upsert-inflight", upsert.MaxInFlight, "number of concurrent upsert requests")
+	flag.BoolVar(&gzip, "embed-gzip", false, "compress requests to embedding service")
+	flag.BoolVar(&skipDuplicates, "skip-duplicates", false, "skip frames which content is already ingested under other point identity, e.g. copies of files with path identity")
+	flag.BoolVar(&skipNearDuplicates, "skip-near-duplicates", false, "skip frames which perceptual hash is within near-duplicate-distance of already ingested ones")
+	flag.IntVar(&nearDistance, "near-duplicate-distance", cbf.NearDuplicateDistance, fmt.Sprintf("maximum Hamming distance of perceptual hashes of near-duplicates, at most %d", cbf.NearDuplicateDistance))
 	flag.Parse()
 
 	client, err := qdrant.NewQdrantClient(qurl, qcol, fext, verbose)
 	if err != nil {
 		panic(err)
 	}
-	err = client.BatchIngest(file, nworkers, size, timeoutLimit, eurl)
+	if method == "" {
+		// existing collection is re-ingested with its own method, projection
+		// suffix of the method is given by projection file
+		if method, err = client.CollectionMethod(context.Background()); err != nil {
+			panic(err)
+		}
+		method, _, _ = strings.Cut(method, "|")
+	}
+	if method == "" {
+		method = embed.DefaultMethod
+		if eurl != "" {
+			method = embed.MethodResNet
+		}
+	}
+	retry := embed.DefaultRetryPolicy()
+	retry.MaxRetries = retries
+	client.Embedder, err = embed.New(method, embed.Options{URL: eurl, Size: size, Gzip: gzip, Retry: &retry, Verbose: verbose, Logf: log.Printf})
 	if err != nil {
-		fmt.Println("ERROR: batch ingestion error", err)
+		panic(err)
+	}
+	if projection != "" {
+		proj, err := embed.LoadProjection(projection)
+		if err != nil {
+			panic(err)
+		}
+		if client.Embedder, err = embed.Project(client.Embedder, proj); err != nil {
+			panic(err)
+		}
+	}
+	var cache *embed.Cache
+	if cacheDir != "" {
+		if cache, err = embed.OpenCache(cacheDir, int64(cacheSize)<<20); err != nil {
+			panic(err)
+		}
+		client.Embedder = embed.WithCache(client.Embedder, cache)
+	}
+	if clipURL != "" {
+		if clipCol == "" {
+			clipCol = qcol + "_clip"
+		}
+		clip, err := embed.New(embed.MethodCLIP, embed.Options{URL: clipURL, Retry: &retry, Verbose: verbose, Logf: log.Printf})
+		if err != nil {
+			panic(err)
+		}
+		client.Clip = client.WithCollection(clipCol)
+		client.Clip.Embedder = embed.WithCache(clip, cache)
+	}
+	if nearDistance < 0 || nearDistance > cbf.NearDuplicateDistance {
+		panic(fmt.Sprintf("near-duplicate distance must be within 0-%d", cbf.NearDuplicateDistance))
+	}
+	client.SkipDuplicates = skipDuplicates
+	client.SkipNearDuplicates = skipNearDuplicates
+	client.NearDuplicateDistance = nearDistance
+	client.UpsertParams = upsert
+	if client.Identity, err = qdrant.ParseIdentityKey(identity); err != nil {
+		panic(err)
+	}
+	client.Walk = walk.Options{
+		Recursive: recursive,
+		MaxDepth:  maxDepth,
+		Include:   splitPatterns(include),
+		Exclude:   splitPatterns(exclude),
+		Hidden:    hidden,
+	}
+	if client.Walk.Symlinks, err = walk.ParseSymlinkPolicy(symlinks); err != nil {
+		panic(err)
+	}
+	if client.Background, err = cbf.ParseBackgroundMethod(background); err != nil {
+		panic(err)
+	}
+	if maskFile != "" {
+		if client.Mask, client.MaskWidth, client.MaskHeight, err = cbf.ReadMask(maskFile); err != nil {
+			panic(err)
+		}
+	}
+	switch onError {
+	case "continue":
+	case "fail-fast":
+		policy.FailFast = true
+	default:
+		panic(fmt.Sprintf("unsupported error policy '%s', use continue or fail-fast", onError))
+	}
+	client.ErrorPolicy = policy
+	client.ErrorReport = errorReport
+	client.FileTimeout = fileTimeout
+	if resume && manifest == "" {
+		panic("resume requires manifest file")
+	}
+	if manifest != "" {
+		if client.Manifest, err = qdrant.OpenManifest(manifest, resume); err != nil {
+			panic(err)
+		}
+		client.Resume = resume
+	}
+	ingestErr := client.BatchIngest(file, nworkers, timeoutLimit)
+	if ingestErr != nil {
+		fmt.Println("ERROR: batch ingestion error", ingestErr)
+	}
+	if client.Manifest != nil {
+		if err := client.Manifest.Close(); err != nil {
+			fmt.Println("ERROR: unable to write manifest", err)
+		}
+	}
+	if ingestErr != nil {
+		os.Exit(1)
+	}
+}
+
+// splitPatterns splits comma separated list of patterns
+func splitPatterns(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
 	}
+	return out
 }
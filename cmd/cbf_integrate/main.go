@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"cbf2go/internal/cbf"
+)
+
+func main() {
+	var fin, fout, format, unit, maskFile string
+	var bins, verbose int
+	var rmin, rmax float64
+	flag.StringVar(&fin, "fin", "", "CBF file")
+	flag.StringVar(&fout, "fout", "", "output file (default stdout)")
+	flag.StringVar(&format, "format", "csv", "output format: csv or json")
+	flag.StringVar(&maskFile, "mask", "", "mask PNG file with pixels to exclude")
+	flag.StringVar(&unit, "unit", "q", "radial unit: r (pixels), q (1/A), 2theta (deg) or d (A)")
+	flag.IntVar(&bins, "bins", cbf.DefaultIntegrateBins, "number of radial bins")
+	flag.Float64Var(&rmin, "min", 0, "lower limit of radial range (q for unit d), 0 means auto")
+	flag.Float64Var(&rmax, "max", 0, "upper limit of radial range (q for unit d), 0 means auto")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file name is provided")
+	}
+	u, err := cbf.ParseUnit(unit)
+	if err != nil {
+		panic(err)
+	}
+
+	frame, err := cbf.ReadFrame(fin, verbose)
+	if err != nil {
+		panic(err)
+	}
+	var mask cbf.Mask
+	if maskFile != "" {
+		extra, err := cbf.LoadMask(maskFile, frame)
+		if err != nil {
+			panic(err)
+		}
+		mask = frame.DefaultMask().Merge(extra)
+	}
+	prof, err := cbf.Integrate(frame, mask, cbf.IntegrateParams{Unit: u, Bins: bins, Min: rmin, Max: rmax})
+	if err != nil {
+		panic(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if fout != "" {
+		f, err := os.Create(fout)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(prof)
+	} else {
+		err = writeCSV(out, prof)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if fout != "" {
+		fmt.Println("created:", fout)
+	}
+}
+
+// writeCSV writes profile bins as CSV records
+func writeCSV(out io.Writer, prof *cbf.Profile) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{string(prof.Unit), "low", "high", "mean", "sum", "count"}); err != nil {
+		return err
+	}
+	ftoa := func(v float64) string { return strconv.FormatFloat(v, 'g', 8, 64) }
+	for _, b := range prof.Bins {
+		rec := []string{ftoa(b.Center), ftoa(b.Low), ftoa(b.High), ftoa(b.Mean), ftoa(b.Sum), strconv.Itoa(b.Count)}
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"cbf2go/internal/qdrant"
+)
+
+func main() {
+	var fin, format, status string
+	var nerrors int
+	flag.StringVar(&fin, "fin", "", "manifest file written by cbf_ingest -manifest")
+	flag.StringVar(&format, "format", "table", "output format: table or json")
+	flag.StringVar(&status, "status", "", "list files with given status: ingested, queued, skipped or failed")
+	flag.IntVar(&nerrors, "errors", 10, "number of most frequent errors to print")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No manifest file is provided")
+	}
+	records, err := qdrant.ReadManifest(fin)
+	if err != nil {
+		panic(err)
+	}
+
+	if status != "" {
+		var out []qdrant.ManifestRecord
+		for _, rec := range qdrant.SortedRecords(records) {
+			if rec.Status == qdrant.FileStatus(status) {
+				out = append(out, rec)
+			}
+		}
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(out); err != nil {
+				panic(err)
+			}
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "path\tsize\tmtime\tid\terror")
+		for _, rec := range out {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", rec.Path, rec.Size, rec.Mtime.Format(time.RFC3339), rec.ID, rec.Error)
+		}
+		tw.Flush()
+		return
+	}
+
+	summary := qdrant.Summarize(records)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	fmt.Printf("manifest: %s\n", fin)
+	fmt.Printf("files:    %d (%.1f MB)\n", summary.Files, float64(summary.Bytes)/(1<<20))
+	for _, s := range []qdrant.FileStatus{qdrant.StatusIngested, qdrant.StatusQueued, qdrant.StatusSkipped, qdrant.StatusFailed} {
+		fmt.Printf("%-9s %d\n", s+":", summary.Statuses[s])
+	}
+	if summary.Files > 0 {
+		fmt.Printf("period:   %s - %s\n", summary.First.Format(time.RFC3339), summary.Last.Format(time.RFC3339))
+	}
+	if len(summary.Errors) == 0 {
+		return
+	}
+	msgs := make([]string, 0, len(summary.Errors))
+	for msg := range summary.Errors {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return summary.Errors[msgs[i]] > summary.Errors[msgs[j]] })
+	fmt.Println("errors:")
+	for _, msg := range msgs[:min(nerrors, len(msgs))] {
+		fmt.Printf("  %d\t%s\n", summary.Errors[msg], msg)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/walk"
+)
+
+func main() {
+	var fin, fout, fext string
+	var nframes, verbose int
+	var detector bool
+	params := cbf.DefaultShadowParams()
+	flag.StringVar(&fin, "fin", "", "CBF file or directory with frames of a sweep to sum")
+	flag.StringVar(&fout, "fout", "mask.png", "output mask PNG file")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use for directories")
+	flag.IntVar(&nframes, "n", 100, "maximum number of sweep frames to sum")
+	flag.BoolVar(&detector, "detector-mask", false, "include detector gaps and bad pixels into the mask")
+	flag.IntVar(&params.BlockSize, "block-size", params.BlockSize, "size of pixel blocks")
+	flag.Float64Var(&params.Threshold, "threshold", params.Threshold, "shadow threshold as a fraction of radial median")
+	flag.Float64Var(&params.CenterRadius, "center-radius", params.CenterRadius, "shadows must reach this distance from beam center (pixels)")
+	flag.IntVar(&params.Dilate, "dilate", params.Dilate, "number of pixels to grow the mask by")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file or directory is provided")
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+	if len(files) > nframes {
+		files = files[:nframes]
+	}
+	if len(files) == 0 {
+		panic("No CBF files found")
+	}
+
+	// sum sweep frames to improve statistics of low count regions
+	var sum *cbf.Frame
+	for _, fname := range files {
+		frame, err := cbf.ReadFrame(fname, verbose)
+		if err != nil {
+			panic(fmt.Errorf("file %s: %w", fname, err))
+		}
+		if sum == nil {
+			sum = frame
+			continue
+		}
+		if sum, err = cbf.Combine([]*cbf.Frame{sum, frame}, cbf.OpSum); err != nil {
+			panic(err)
+		}
+	}
+
+	dmask := sum.DefaultMask()
+	mask := cbf.DetectShadow(sum, dmask, params)
+	fmt.Printf("shadow mask: %d pixels from %d frames\n", mask.Count(), len(files))
+	if detector {
+		mask = mask.Merge(dmask)
+	}
+	if err := cbf.WriteMask(fout, mask, sum.Width, sum.Height); err != nil {
+		panic(err)
+	}
+	fmt.Println("created:", fout)
+}
@@ -8,11 +8,13 @@ import (
 )
 
 func main() {
-	var fin, fout, format string
+	var fin, fout, format, maskFile, background string
 	var verbose int
 	flag.StringVar(&fin, "fin", "", "CBF file")
 	flag.StringVar(&fout, "fout", "", "output file")
 	flag.StringVar(&format, "format", "color", "output PNG format: color or gray")
+	flag.StringVar(&maskFile, "mask", "", "mask PNG file, masked pixels are rendered as detector gaps")
+	flag.StringVar(&background, "background", "none", "background to subtract before rendering: none, radial, median or rollingball")
 	flag.IntVar(&verbose, "verbose", 0, "verbose level")
 	flag.Parse()
 
@@ -20,10 +22,29 @@ func main() {
 		panic("No input or output file name is provided")
 	}
 
-	pixels, w, h, err := cbf.ReadCBF(fin, verbose)
+	frame, err := cbf.ReadFrame(fin, verbose)
 	if err != nil {
 		panic(err)
 	}
+	if maskFile != "" {
+		mask, err := cbf.LoadMask(maskFile, frame)
+		if err != nil {
+			panic(err)
+		}
+		if err := frame.ApplyMask(mask, cbf.MaskedValue); err != nil {
+			panic(err)
+		}
+	}
+	method, err := cbf.ParseBackgroundMethod(background)
+	if err != nil {
+		panic(err)
+	}
+	if method != cbf.BackgroundNone {
+		if frame, err = cbf.SubtractBackground(frame, nil, method, cbf.DefaultBackgroundParams()); err != nil {
+			panic(err)
+		}
+	}
+	pixels, w, h := frame.Pixels, frame.Width, frame.Height
 
 	if format == "gray" {
 		err = cbf.WritePNG(pixels, w, h, fout)
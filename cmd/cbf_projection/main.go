@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
+	"cbf2go/internal/walk"
+)
+
+func main() {
+	var fin, fout, fext, method, eurl, ptype string
+	var size, dim, nframes, recallK, batchSize, verbose int
+	var gzip bool
+	var seed int64
+	flag.StringVar(&fin, "fin", "", "directory with sample CBF frames")
+	flag.StringVar(&fout, "fout", "projection.bin", "output projection file")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use for directories")
+	flag.StringVar(&method, "method", embed.DefaultMethod, fmt.Sprintf("embedding method to reduce: %s", strings.Join(embed.Methods(), ", ")))
+	flag.StringVar(&eurl, "embed-url", "", "URL of embedding service")
+	flag.StringVar(&ptype, "type", embed.ProjectionPCA, "projection type: pca or random")
+	flag.IntVar(&size, "embed-size", 512, "embedding image size of local methods")
+	flag.IntVar(&dim, "dim", 128, "output dimension")
+	flag.IntVar(&nframes, "n", 500, "maximum number of sample frames")
+	flag.Int64Var(&seed, "seed", 1, "seed of random projection and frame sampling")
+	flag.IntVar(&recallK, "recall-k", 10, "number of neighbours used to measure neighbour recall")
+	flag.IntVar(&batchSize, "batch-size", 8, "number of frames sent to embedding service in one request")
+	flag.BoolVar(&gzip, "embed-gzip", false, "compress requests to embedding service")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file or directory is provided")
+	}
+	embedder, err := embed.New(method, embed.Options{URL: eurl, Size: size, Gzip: gzip, Verbose: verbose, Logf: log.Printf})
+	if err != nil {
+		panic(err)
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+	if len(files) > nframes {
+		// random sample of frames, seeded to make fit reproducible
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+		files = files[:nframes]
+	}
+
+	// embed frames in batches, remote methods send every batch in one request
+	ctx := context.Background()
+	var vecs [][]float32
+	var batch []*cbf.Frame
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		out, err := embed.EmbedFrames(ctx, embedder, batch)
+		if err != nil {
+			panic(err)
+		}
+		vecs = append(vecs, out...)
+		batch = batch[:0]
+	}
+	for _, fname := range files {
+		frame, err := cbf.ReadFrame(fname, verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", fname, err)
+			continue
+		}
+		batch = append(batch, frame)
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+	if len(vecs) == 0 {
+		panic("No frames are embedded")
+	}
+
+	var proj *embed.Projection
+	switch ptype {
+	case embed.ProjectionPCA:
+		if proj, err = embed.FitPCA(embedder.Name(), vecs, dim); err != nil {
+			panic(err)
+		}
+	case embed.ProjectionRandom:
+		proj = embed.NewRandomProjection(embedder.Name(), len(vecs[0]), dim, seed)
+	default:
+		panic(fmt.Sprintf("unsupported projection type %q", ptype))
+	}
+	if err := embed.SaveProjection(fout, proj); err != nil {
+		panic(err)
+	}
+
+	// neighbour quality of projected vectors on the sample
+	projected := make([][]float32, len(vecs))
+	for i, v := range vecs {
+		if projected[i], err = proj.Apply(v); err != nil {
+			panic(err)
+		}
+	}
+	var explained float64
+	for _, v := range proj.Explained {
+		explained += v
+	}
+	fmt.Printf("projection: %s %d -> %d dimensions, fitted on %d frames\n", proj.Type, proj.InputDim, proj.OutputDim, len(vecs))
+	if proj.Type == embed.ProjectionPCA {
+		fmt.Printf("explained variance: %.4f\n", explained)
+	}
+	fmt.Printf("neighbour recall@%d: %.4f\n", recallK, embed.NeighbourRecall(vecs, projected, recallK))
+	fmt.Printf("method: %s\n", embedder.Name()+proj.Suffix())
+	fmt.Println("created:", fout)
+}
@@ -22,7 +22,19 @@ type Config struct {
 	} `json:"qdrant" yaml:"qdrant"`
 	Embed struct {
 		URL string `json:"url" yaml:"url"`
+		// projection files of collections with reduced embeddings
+		Projections []string `json:"projections" yaml:"projections"`
+		// directory and size limit (MB) of embedding cache
+		Cache     string `json:"cache" yaml:"cache"`
+		CacheSize int    `json:"cache_size" yaml:"cache_size"`
 	}
+	Clip struct {
+		URL string `json:"url" yaml:"url"`
+		// collection of CLIP embeddings populated by cbf_ingest -clip-url
+		Collection string `json:"collection" yaml:"collection"`
+	} `json:"clip" yaml:"clip"`
+	// mask PNG file with shadowed pixels to exclude from search frames
+	Mask string `json:"mask" yaml:"mask"`
 }
 
 // LoadConfig reads JSON or YAML file based on extension
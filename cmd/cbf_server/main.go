@@ -7,6 +7,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
 	"cbf2go/internal/httpapi"
 	"cbf2go/internal/qdrant"
 )
@@ -58,6 +60,37 @@ func main() {
 		Qdrant:   client,
 		EmbedURL: cfg.Embed.URL,
 	}
+	if cfg.Mask != "" {
+		if server.Mask, server.MaskWidth, server.MaskHeight, err = cbf.ReadMask(cfg.Mask); err != nil {
+			log.Fatalf("failed to read mask %q: %v", cfg.Mask, err)
+		}
+	}
+
+	for _, fname := range cfg.Embed.Projections {
+		proj, err := embed.LoadProjection(fname)
+		if err != nil {
+			log.Fatalf("failed to load projection %q: %v", fname, err)
+		}
+		embed.RegisterProjection(proj)
+	}
+
+	if cfg.Embed.Cache != "" {
+		if cfg.Embed.CacheSize == 0 {
+			cfg.Embed.CacheSize = 1024
+		}
+		if server.Cache, err = embed.OpenCache(cfg.Embed.Cache, int64(cfg.Embed.CacheSize)<<20); err != nil {
+			log.Fatalf("failed to open embedding cache %q: %v", cfg.Embed.Cache, err)
+		}
+	}
+
+	if cfg.Clip.URL != "" {
+		if cfg.Clip.Collection == "" {
+			cfg.Clip.Collection = cfg.Qdrant.Collection + "_clip"
+		}
+		server.Clip = embed.NewCLIPClient(cfg.Clip.URL)
+		server.Clip.Breaker.Logf = log.Printf
+		server.ClipCollection = cfg.Clip.Collection
+	}
 
 	server.Register(r)
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"cbf2go/internal/cbf"
+)
+
+func main() {
+	var fin, format, maskFile string
+	var verbose int
+	params := cbf.DefaultSpotParams()
+	flag.StringVar(&fin, "fin", "", "CBF file")
+	flag.StringVar(&format, "format", "table", "output format: table, json or count")
+	flag.StringVar(&maskFile, "mask", "", "mask PNG file with pixels to exclude")
+	flag.IntVar(&params.KernelSize, "kernel-size", params.KernelSize, "half size of local window")
+	flag.Float64Var(&params.SigmaBackground, "sigma-background", params.SigmaBackground, "dispersion threshold")
+	flag.Float64Var(&params.SigmaStrong, "sigma-strong", params.SigmaStrong, "strong pixel threshold")
+	flag.Float64Var(&params.GlobalThreshold, "global-threshold", params.GlobalThreshold, "minimum pixel value of strong pixels")
+	flag.IntVar(&params.MinLocal, "min-local", params.MinLocal, "minimum number of valid pixels in local window")
+	flag.IntVar(&params.MinSpotSize, "min-spot-size", params.MinSpotSize, "minimum number of pixels in a spot")
+	flag.IntVar(&params.MaxSpotSize, "max-spot-size", params.MaxSpotSize, "maximum number of pixels in a spot")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file name is provided")
+	}
+
+	frame, err := cbf.ReadFrame(fin, verbose)
+	if err != nil {
+		panic(err)
+	}
+	var mask cbf.Mask
+	if maskFile != "" {
+		extra, err := cbf.LoadMask(maskFile, frame)
+		if err != nil {
+			panic(err)
+		}
+		mask = frame.DefaultMask().Merge(extra)
+	}
+	spots := cbf.FindSpots(frame, mask, params)
+
+	switch format {
+	case "count":
+		fmt.Println(len(spots))
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		rec := map[string]any{"file": fin, "n_spots": len(spots), "spots": spots}
+		if err := enc.Encode(rec); err != nil {
+			panic(err)
+		}
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "x\ty\tintensity\tpeak\tsize\t")
+		for _, s := range spots {
+			fmt.Fprintf(tw, "%.2f\t%.2f\t%d\t%d\t%d\t\n", s.X, s.Y, s.Intensity, s.Peak, s.Size)
+		}
+		tw.Flush()
+		fmt.Printf("found %d spots\n", len(spots))
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/walk"
+)
+
+// FileStats represents statistics of single CBF file
+type FileStats struct {
+	File       string  `json:"file"`
+	NSpots     int     `json:"n_spots"`
+	Resolution float64 `json:"resolution"`
+	cbf.Stats
+}
+
+func main() {
+	var fin, format, fext, maskFile string
+	var nbins, verbose int
+	flag.StringVar(&fin, "fin", "", "CBF file or directory with CBF files")
+	flag.StringVar(&format, "format", "table", "output format: table or json")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use for directories")
+	flag.StringVar(&maskFile, "mask", "", "mask PNG file with pixels to exclude")
+	flag.IntVar(&nbins, "bins", cbf.DefaultHistogramBins, "number of histogram bins")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input file or directory is provided")
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+
+	// mask is loaded for the first frame and checked again for frames of
+	// other size
+	var extra cbf.Mask
+	var maskWidth, maskHeight int
+
+	var records []FileStats
+	for _, fname := range files {
+		frame, err := cbf.ReadFrame(fname, verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", fname, err)
+			continue
+		}
+		mask := frame.DefaultMask()
+		if maskFile != "" {
+			if extra == nil || frame.Width != maskWidth || frame.Height != maskHeight {
+				if extra, err = cbf.LoadMask(maskFile, frame); err != nil {
+					panic(fmt.Sprintf("%s: %v", fname, err))
+				}
+				maskWidth, maskHeight = frame.Width, frame.Height
+			}
+			mask = mask.Merge(extra)
+		}
+		spots := cbf.FindSpots(frame, mask, cbf.DefaultSpotParams())
+		res, err := cbf.EstimateResolution(frame, spots, cbf.DefaultResolutionParams())
+		if err != nil && verbose > 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %v\n", fname, err)
+		}
+		records = append(records, FileStats{
+			File:       fname,
+			NSpots:     len(spots),
+			Resolution: res,
+			Stats:      cbf.ComputeStats(frame, mask, nbins),
+		})
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(records); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "file\tmin\tmax\tmean\tmedian\tstddev\tmasked\tzero\toverloaded\ttotal\tspots\tresolution\t")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.3f\t%.1f\t%.3f\t%d\t%d\t%d\t%d\t%d\t%.2f\t\n",
+			filepath.Base(r.File), r.Min, r.Max, r.Mean, r.Median, r.StdDev,
+			r.Masked, r.Zero, r.Overloaded, r.Total, r.NSpots, r.Resolution)
+	}
+	tw.Flush()
+}
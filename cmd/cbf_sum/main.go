@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/walk"
+)
+
+func main() {
+	var fin, odir, prefix, fext, operation, dark string
+	var nframes, verbose int
+	var scale float64
+	flag.StringVar(&fin, "fin", "", "directory with CBF frames of a sweep")
+	flag.StringVar(&odir, "odir", ".", "output directory")
+	flag.StringVar(&prefix, "prefix", "sum", "output file name prefix")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use")
+	flag.StringVar(&operation, "op", "sum", "operation: sum, mean, median or max")
+	flag.StringVar(&dark, "dark", "", "dark/background CBF frame to subtract from every input frame")
+	flag.IntVar(&nframes, "n", 10, "number of frames to combine")
+	flag.Float64Var(&scale, "scale", 1, "scale factor applied to combined frames")
+	flag.IntVar(&verbose, "verbose", 0, "verbose level")
+	flag.Parse()
+
+	if fin == "" || nframes <= 0 {
+		panic("No input directory or invalid number of frames is provided")
+	}
+	op, err := cbf.ParseOperation(operation)
+	if err != nil {
+		panic(err)
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+
+	var darkFrame *cbf.Frame
+	if dark != "" {
+		darkFrame, err = cbf.ReadFrame(dark, verbose)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for i, idx := 0, 1; i < len(files); i, idx = i+nframes, idx+1 {
+		wedge := files[i:min(i+nframes, len(files))]
+		frames := make([]*cbf.Frame, 0, len(wedge))
+		for _, fname := range wedge {
+			frame, err := cbf.ReadFrame(fname, verbose)
+			if err != nil {
+				panic(fmt.Errorf("file %s: %w", fname, err))
+			}
+			if darkFrame != nil {
+				if frame, err = cbf.Subtract(frame, darkFrame); err != nil {
+					panic(fmt.Errorf("file %s: %w", fname, err))
+				}
+			}
+			frames = append(frames, frame)
+		}
+
+		out, err := cbf.Combine(frames, op)
+		if err != nil {
+			panic(err)
+		}
+		if scale != 1 {
+			if out, err = cbf.Scale(out, scale); err != nil {
+				panic(err)
+			}
+		}
+
+		fout := filepath.Join(odir, fmt.Sprintf("%s_%05d.%s", prefix, idx, strings.TrimPrefix(fext, ".")))
+		if err := cbf.WriteCBF(fout, out); err != nil {
+			panic(err)
+		}
+		fmt.Printf("created: %s (%s of %d frames, start angle %.4f, range %.4f deg)\n",
+			fout, op, len(frames), out.Meta.StartAngle, out.Meta.AngleIncrement)
+	}
+}
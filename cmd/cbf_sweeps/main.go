@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"cbf2go/internal/sweep"
+	"cbf2go/internal/walk"
+)
+
+func main() {
+	var fin, format, fext string
+	var headers bool
+	var tolerance float64
+	flag.StringVar(&fin, "fin", "", "directory with CBF files")
+	flag.StringVar(&format, "format", "table", "output format: table or json")
+	flag.StringVar(&fext, "file-extension", "cbf", "CBF file extension to use")
+	flag.BoolVar(&headers, "headers", false, "check start angle continuity from file headers")
+	flag.Float64Var(&tolerance, "tolerance", 0.001, "start angle tolerance in degrees")
+	flag.Parse()
+
+	if fin == "" {
+		panic("No input directory is provided")
+	}
+
+	files, err := walk.Files(fin, walk.Options{Include: []string{"*." + fext}})
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+
+	sweeps := sweep.Group(files)
+	if headers {
+		for _, s := range sweeps {
+			if err := s.CheckHeaders(tolerance); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: sweep %s: %v\n", s.Template, err)
+			}
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sweeps); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "id\ttemplate\tframes\tfirst\tlast\tgaps\tout_of_order\twarnings")
+	for _, s := range sweeps {
+		var gaps []string
+		for _, g := range s.Gaps {
+			if g[0] == g[1] {
+				gaps = append(gaps, fmt.Sprint(g[0]))
+			} else {
+				gaps = append(gaps, fmt.Sprintf("%d-%d", g[0], g[1]))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%d\t%d\n",
+			s.ID, s.Template, len(s.Frames), s.First, s.Last,
+			strings.Join(gaps, ","), len(s.OutOfOrder), len(s.Warnings))
+	}
+	tw.Flush()
+	for _, s := range sweeps {
+		for _, w := range s.Warnings {
+			fmt.Printf("WARNING: %s: %s\n", s.Template, w)
+		}
+	}
+}
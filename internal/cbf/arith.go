@@ -0,0 +1,207 @@
+package cbf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// value used for masked pixels of computed frames (PILATUS gap value)
+var MaskedValue int32 = -1
+
+// Operation represents frame reduction operation
+type Operation string
+
+const (
+	OpSum    Operation = "sum"
+	OpMean   Operation = "mean"
+	OpMedian Operation = "median"
+	OpMax    Operation = "max"
+)
+
+// ParseOperation converts string to frame reduction operation
+func ParseOperation(s string) (Operation, error) {
+	switch op := Operation(s); op {
+	case OpSum, OpMean, OpMedian, OpMax:
+		return op, nil
+	}
+	return "", fmt.Errorf("unsupported operation %q, should be one of sum, mean, median, max", s)
+}
+
+// Combine reduces frames of the same size pixel by pixel with given
+// operation. A pixel masked (negative) in any frame is masked in the result
+// and a pixel overloaded in any frame is set to the count cutoff of the
+// result. Values are accumulated in int64 and clamped to int32 range.
+// Header of the result is merged from input headers, see MergeMetadata.
+func Combine(frames []*Frame, op Operation) (*Frame, error) {
+	if err := checkFrames(frames); err != nil {
+		return nil, err
+	}
+	var reduce func(vals []int64) int64
+	switch op {
+	case OpSum:
+		reduce = func(vals []int64) int64 {
+			var s int64
+			for _, v := range vals {
+				s += v
+			}
+			return s
+		}
+	case OpMean:
+		reduce = func(vals []int64) int64 {
+			var s int64
+			for _, v := range vals {
+				s += v
+			}
+			return int64(math.Round(float64(s) / float64(len(vals))))
+		}
+	case OpMedian:
+		reduce = func(vals []int64) int64 {
+			slices.Sort(vals)
+			n := len(vals)
+			if n%2 == 1 {
+				return vals[n/2]
+			}
+			return int64(math.Round(float64(vals[n/2-1]+vals[n/2]) / 2))
+		}
+	case OpMax:
+		reduce = func(vals []int64) int64 {
+			return slices.Max(vals)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op)
+	}
+
+	out := newFrameLike(frames[0])
+	out.Meta = MergeMetadata(frames, op)
+	vals := make([]int64, len(frames))
+	for i := range out.Pixels {
+		masked, overloaded := false, false
+		for j, f := range frames {
+			v := f.Pixels[i]
+			masked = masked || v < 0
+			overloaded = overloaded || f.Overloaded(v)
+			vals[j] = int64(v)
+		}
+		switch {
+		case masked:
+			out.Pixels[i] = MaskedValue
+		case overloaded:
+			out.Pixels[i] = out.Meta.CountCutoff
+		default:
+			out.Pixels[i] = clampInt32(reduce(vals))
+		}
+	}
+	return out, nil
+}
+
+// Subtract returns a - b, e.g. dark or background subtraction. Pixels masked
+// in either frame are masked, overloaded pixels of a are kept overloaded and
+// negative differences are clamped to zero since negative values denote
+// masked pixels in CBF files.
+func Subtract(a, b *Frame) (*Frame, error) {
+	if err := checkFrames([]*Frame{a, b}); err != nil {
+		return nil, err
+	}
+	out := newFrameLike(a)
+	for i, v := range a.Pixels {
+		w := b.Pixels[i]
+		switch {
+		case v < 0 || w < 0:
+			out.Pixels[i] = MaskedValue
+		case a.Overloaded(v):
+			out.Pixels[i] = v
+		default:
+			out.Pixels[i] = clampInt32(max(int64(v)-int64(w), 0))
+		}
+	}
+	return out, nil
+}
+
+// Scale multiplies unmasked pixels and count cutoff of a frame by given
+// factor, results are rounded and clamped to valid counts range
+func Scale(f *Frame, factor float64) (*Frame, error) {
+	if factor < 0 {
+		return nil, fmt.Errorf("negative scale factor %f", factor)
+	}
+	out := newFrameLike(f)
+	out.Meta.CountCutoff = clampInt32(int64(math.Round(float64(f.Meta.CountCutoff) * factor)))
+	for i, v := range f.Pixels {
+		switch {
+		case v < 0:
+			out.Pixels[i] = v
+		case f.Overloaded(v):
+			out.Pixels[i] = out.Meta.CountCutoff
+		default:
+			out.Pixels[i] = clampInt32(int64(math.Round(float64(v) * factor)))
+		}
+	}
+	return out, nil
+}
+
+// MergeMetadata merges headers of frames of a sweep: start angle is taken
+// from the first frame and angle increment covers combined angle range.
+// For sum exposure time and count cutoff are summed, for other operations
+// they are averaged.
+func MergeMetadata(frames []*Frame, op Operation) Metadata {
+	m := frames[0].Meta
+	var exposure, increment float64
+	var cutoff int64
+	for _, f := range frames {
+		exposure += f.Meta.ExposureTime
+		increment += f.Meta.AngleIncrement
+		cutoff += int64(f.Meta.CountCutoff)
+	}
+	m.AngleIncrement = increment
+	n := float64(len(frames))
+	if op == OpSum {
+		m.ExposureTime = exposure
+		m.CountCutoff = clampInt32(cutoff)
+	} else {
+		m.ExposureTime = exposure / n
+		m.CountCutoff = clampInt32(int64(math.Round(float64(cutoff) / n)))
+	}
+	return m
+}
+
+// checkFrames checks that frames are provided and have the same dimensions
+func checkFrames(frames []*Frame) error {
+	if len(frames) == 0 {
+		return errors.New("no frames provided")
+	}
+	w, h := frames[0].Width, frames[0].Height
+	for _, f := range frames {
+		if f.Width != w || f.Height != h || len(f.Pixels) != w*h {
+			return fmt.Errorf("frame size mismatch: %dx%d vs %dx%d", f.Width, f.Height, w, h)
+		}
+	}
+	return nil
+}
+
+// newFrameLike returns frame with the same dimensions and header as given one
+func newFrameLike(f *Frame) *Frame {
+	header := make(map[string]string, len(f.Header))
+	for k, v := range f.Header {
+		header[k] = v
+	}
+	return &Frame{
+		Pixels:   make([]int32, len(f.Pixels)),
+		Width:    f.Width,
+		Height:   f.Height,
+		Header:   header,
+		Meta:     f.Meta,
+		Contents: slices.Clone(f.Contents),
+	}
+}
+
+// clampInt32 clamps value to non-negative int32 range
+func clampInt32(v int64) int32 {
+	if v > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if v < 0 {
+		return 0
+	}
+	return int32(v)
+}
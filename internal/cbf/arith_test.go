@@ -0,0 +1,162 @@
+package cbf
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// testFrame returns 1-row frame of given pixels and count cutoff
+func testFrame(cutoff int32, pixels ...int32) *Frame {
+	return &Frame{
+		Pixels: pixels,
+		Width:  len(pixels),
+		Height: 1,
+		Meta:   Metadata{CountCutoff: cutoff, ExposureTime: 0.1, StartAngle: 10, AngleIncrement: 0.5},
+	}
+}
+
+func TestCombine(t *testing.T) {
+	frames := []*Frame{
+		testFrame(1000, 1, 10, -1, 5, 999, 1000),
+		testFrame(1000, 2, 20, 7, -2, 1, 3),
+		testFrame(1000, 6, 60, 8, 9, 2, 4),
+	}
+	cases := []struct {
+		op   Operation
+		want []int32
+	}{
+		// masked pixels are masked and overloaded ones are set to the
+		// cutoff of the result, 3000 for sum
+		{OpSum, []int32{9, 90, -1, -1, 1002, 3000}},
+		{OpMean, []int32{3, 30, -1, -1, 334, 1000}},
+		{OpMedian, []int32{2, 20, -1, -1, 2, 1000}},
+		{OpMax, []int32{6, 60, -1, -1, 999, 1000}},
+	}
+	for _, c := range cases {
+		out, err := Combine(frames, c.op)
+		if err != nil {
+			t.Fatalf("%s: %v", c.op, err)
+		}
+		if !slices.Equal(out.Pixels, c.want) {
+			t.Errorf("%s: got %v, expected %v", c.op, out.Pixels, c.want)
+		}
+	}
+}
+
+func TestCombineMedianEven(t *testing.T) {
+	frames := []*Frame{testFrame(0, 1, 4), testFrame(0, 2, 10), testFrame(0, 8, 5), testFrame(0, 3, 7)}
+	out, err := Combine(frames, OpMedian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mean of two middle values rounded half away from zero
+	if want := []int32{3, 6}; !slices.Equal(out.Pixels, want) {
+		t.Errorf("got %v, expected %v", out.Pixels, want)
+	}
+}
+
+func TestCombineClamp(t *testing.T) {
+	frames := []*Frame{testFrame(0, math.MaxInt32-1, 7), testFrame(0, math.MaxInt32-1, 8)}
+	out, err := Combine(frames, OpSum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{math.MaxInt32, 15}; !slices.Equal(out.Pixels, want) {
+		t.Errorf("got %v, expected %v", out.Pixels, want)
+	}
+	// mean is computed before clamping
+	out, err = Combine(frames, OpMean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Pixels[0] != math.MaxInt32-1 {
+		t.Errorf("got mean %d, expected %d", out.Pixels[0], math.MaxInt32-1)
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	if _, err := Combine(nil, OpSum); err == nil {
+		t.Error("expected error of no frames")
+	}
+	if _, err := Combine([]*Frame{testFrame(0, 1, 2), testFrame(0, 1, 2, 3)}, OpSum); err == nil {
+		t.Error("expected error of size mismatch")
+	}
+	if _, err := Combine([]*Frame{testFrame(0, 1)}, "min"); err == nil {
+		t.Error("expected error of unsupported operation")
+	}
+	if _, err := ParseOperation("min"); err == nil {
+		t.Error("expected error of unsupported operation")
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	a := testFrame(1000, 10, 5, -1, 10, 1000, 1200)
+	b := testFrame(1000, 3, 8, 1, -2, 50, 5)
+	out, err := Subtract(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// negative difference is clamped at zero, overloaded pixels are kept
+	if want := []int32{7, 0, -1, -1, 1000, 1200}; !slices.Equal(out.Pixels, want) {
+		t.Errorf("got %v, expected %v", out.Pixels, want)
+	}
+	if out.Meta != a.Meta {
+		t.Errorf("expected header of the first frame, got %+v", out.Meta)
+	}
+	if _, err := Subtract(a, testFrame(1000, 1)); err == nil {
+		t.Error("expected error of size mismatch")
+	}
+}
+
+func TestScale(t *testing.T) {
+	f := testFrame(1000, 3, -1, 1000, 999)
+	out, err := Scale(f, 2.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{8, -1, 2500, 2498}; !slices.Equal(out.Pixels, want) {
+		t.Errorf("got %v, expected %v", out.Pixels, want)
+	}
+	if out.Meta.CountCutoff != 2500 {
+		t.Errorf("expected scaled count cutoff 2500, got %d", out.Meta.CountCutoff)
+	}
+	if f.Pixels[0] != 3 || f.Meta.CountCutoff != 1000 {
+		t.Error("input frame was modified")
+	}
+	// frame without count cutoff is clamped to int32 range
+	out, err = Scale(testFrame(0, math.MaxInt32/2), 2.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Pixels[0] != math.MaxInt32 {
+		t.Errorf("expected clamped pixel, got %d", out.Pixels[0])
+	}
+	if _, err := Scale(f, -1); err == nil {
+		t.Error("expected error of negative factor")
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	a, b := testFrame(1000, 0), testFrame(1001, 0)
+	b.Meta.StartAngle = 10.5
+	b.Meta.ExposureTime = 0.3
+
+	m := MergeMetadata([]*Frame{a, b}, OpSum)
+	if m.StartAngle != 10 || m.AngleIncrement != 1 {
+		t.Errorf("unexpected angles of merged header: %+v", m)
+	}
+	if math.Abs(m.ExposureTime-0.4) > 1e-12 || m.CountCutoff != 2001 {
+		t.Errorf("expected summed exposure and cutoff, got %+v", m)
+	}
+
+	m = MergeMetadata([]*Frame{a, b}, OpMean)
+	if math.Abs(m.ExposureTime-0.2) > 1e-12 || m.CountCutoff != 1001 {
+		t.Errorf("expected averaged exposure and cutoff, got %+v", m)
+	}
+
+	a.Meta.CountCutoff, b.Meta.CountCutoff = math.MaxInt32, math.MaxInt32
+	if m := MergeMetadata([]*Frame{a, b}, OpSum); m.CountCutoff != math.MaxInt32 {
+		t.Errorf("expected clamped count cutoff, got %d", m.CountCutoff)
+	}
+}
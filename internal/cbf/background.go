@@ -0,0 +1,283 @@
+package cbf
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// BackgroundMethod represents background estimation method
+type BackgroundMethod string
+
+const (
+	BackgroundNone        BackgroundMethod = "none"
+	BackgroundRadial      BackgroundMethod = "radial"      // radially symmetric median background
+	BackgroundMedian      BackgroundMethod = "median"      // median filter over square blocks
+	BackgroundRollingBall BackgroundMethod = "rollingball" // morphological opening (rolling ball with flat structuring element)
+)
+
+// ParseBackgroundMethod converts string to background estimation method,
+// empty string means no background subtraction
+func ParseBackgroundMethod(s string) (BackgroundMethod, error) {
+	switch m := BackgroundMethod(s); m {
+	case "", BackgroundNone:
+		return BackgroundNone, nil
+	case BackgroundRadial, BackgroundMedian, BackgroundRollingBall:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported background method %q, should be one of none, radial, median, rollingball", s)
+}
+
+// BackgroundParams represents parameters of background estimation
+type BackgroundParams struct {
+	RadialBin float64 `json:"radial_bin"` // width of radial bins in pixels for radial method
+	Radius    int     `json:"radius"`     // filter size in pixels for median and rollingball methods
+}
+
+// DefaultBackgroundParams returns default background estimation parameters
+func DefaultBackgroundParams() BackgroundParams {
+	return BackgroundParams{
+		RadialBin: 2,
+		Radius:    16,
+	}
+}
+
+// block size used to suppress counting noise by rolling ball method
+var rollingBallBlock = 4
+
+// EstimateBackground returns per-pixel background of the frame estimated
+// with given method. If mask is nil the frame default mask is used.
+func EstimateBackground(f *Frame, mask Mask, method BackgroundMethod, p BackgroundParams) ([]float64, error) {
+	mask = maskOrDefault(f, mask)
+	switch method {
+	case BackgroundNone, "":
+		return make([]float64, len(f.Pixels)), nil
+	case BackgroundRadial:
+		return radialBackground(f, mask, p), nil
+	case BackgroundMedian:
+		bs := max(p.Radius, 1)
+		grid, gw, gh := blockReduce(f, mask, bs, func(vals []float64) float64 {
+			slices.Sort(vals)
+			return vals[len(vals)/2]
+		})
+		return upsampleBlocks(grid, gw, gh, bs, f.Width, f.Height), nil
+	case BackgroundRollingBall:
+		bs := rollingBallBlock
+		grid, gw, gh := blockReduce(f, mask, bs, func(vals []float64) float64 {
+			var s float64
+			for _, v := range vals {
+				s += v
+			}
+			return s / float64(len(vals))
+		})
+		k := max(p.Radius/bs, 1)
+		grid = morphFilter(grid, gw, gh, k, math.Min, math.Inf(1))
+		grid = morphFilter(grid, gw, gh, k, math.Max, math.Inf(-1))
+		return upsampleBlocks(grid, gw, gh, bs, f.Width, f.Height), nil
+	}
+	return nil, fmt.Errorf("unsupported background method %q", method)
+}
+
+// SubtractBackground returns new frame with estimated background subtracted.
+// Masked and overloaded pixels are kept, other pixels are rounded and
+// clamped to zero.
+func SubtractBackground(f *Frame, mask Mask, method BackgroundMethod, p BackgroundParams) (*Frame, error) {
+	mask = maskOrDefault(f, mask)
+	bg, err := EstimateBackground(f, mask, method, p)
+	if err != nil {
+		return nil, err
+	}
+	out := newFrameLike(f)
+	for i, v := range f.Pixels {
+		switch {
+		case mask[i] || v < 0:
+			out.Pixels[i] = min(v, MaskedValue)
+		case f.Overloaded(v):
+			out.Pixels[i] = v
+		default:
+			out.Pixels[i] = clampInt32(int64(math.Round(float64(v) - bg[i])))
+		}
+	}
+	return out, nil
+}
+
+// radialBackground computes median of unmasked pixels in radial bins and
+// interpolates it linearly to every pixel
+func radialBackground(f *Frame, mask Mask, p BackgroundParams) []float64 {
+	bin := p.RadialBin
+	if bin <= 0 {
+		bin = DefaultBackgroundParams().RadialBin
+	}
+	rad := make([]float64, len(f.Pixels))
+	var bins [][]float64
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			rad[i] = f.Radius(x, y) / bin
+			if mask[i] {
+				continue
+			}
+			idx := int(rad[i])
+			for len(bins) <= idx {
+				bins = append(bins, nil)
+			}
+			bins[idx] = append(bins[idx], float64(f.Pixels[i]))
+		}
+	}
+
+	// bin medians, empty bins take value of the nearest non-empty bin
+	medians := make([]float64, len(bins))
+	valid := make([]bool, len(bins))
+	for i, vals := range bins {
+		if len(vals) > 0 {
+			slices.Sort(vals)
+			medians[i] = vals[len(vals)/2]
+			valid[i] = true
+		}
+	}
+	fillGaps(medians, valid)
+
+	bg := make([]float64, len(f.Pixels))
+	if len(medians) == 0 {
+		return bg
+	}
+	for i, r := range rad {
+		// bin median is assigned to bin center
+		pos := r - 0.5
+		lo := int(math.Floor(pos))
+		t := pos - float64(lo)
+		lo = min(max(lo, 0), len(medians)-1)
+		hi := min(lo+1, len(medians)-1)
+		if pos < 0 {
+			t = 0
+		}
+		bg[i] = medians[lo]*(1-t) + medians[hi]*t
+	}
+	return bg
+}
+
+// blockReduce divides frame into square blocks and reduces unmasked pixel
+// values of every block with given function, blocks without unmasked pixels
+// take value of the nearest valid block in the same row or, if the whole
+// block row is masked, in the same column
+func blockReduce(f *Frame, mask Mask, bs int, reduce func([]float64) float64) ([]float64, int, int) {
+	gw, gh := (f.Width+bs-1)/bs, (f.Height+bs-1)/bs
+	grid := make([]float64, gw*gh)
+	valid := make([]bool, gw*gh)
+	vals := make([]float64, 0, bs*bs)
+	for gy := 0; gy < gh; gy++ {
+		for gx := 0; gx < gw; gx++ {
+			vals = vals[:0]
+			for y := gy * bs; y < min((gy+1)*bs, f.Height); y++ {
+				for x := gx * bs; x < min((gx+1)*bs, f.Width); x++ {
+					i := y*f.Width + x
+					if !mask[i] {
+						vals = append(vals, float64(f.Pixels[i]))
+					}
+				}
+			}
+			if len(vals) > 0 {
+				grid[gy*gw+gx] = reduce(vals)
+				valid[gy*gw+gx] = true
+			}
+		}
+	}
+	fillGrid(grid, valid, gw, gh)
+	return grid, gw, gh
+}
+
+// fillGrid fills invalid blocks of the grid from the nearest valid block in
+// the same row, blocks of rows without valid blocks are filled from the
+// nearest filled row in the same column
+func fillGrid(grid []float64, valid []bool, gw, gh int) {
+	rowValid := make([]bool, gh)
+	for gy := 0; gy < gh; gy++ {
+		row := valid[gy*gw : (gy+1)*gw]
+		for _, v := range row {
+			rowValid[gy] = rowValid[gy] || v
+		}
+		fillGaps(grid[gy*gw:(gy+1)*gw], row)
+	}
+	col := make([]float64, gh)
+	for gx := 0; gx < gw; gx++ {
+		for gy := 0; gy < gh; gy++ {
+			col[gy] = grid[gy*gw+gx]
+		}
+		fillGaps(col, rowValid)
+		for gy := 0; gy < gh; gy++ {
+			grid[gy*gw+gx] = col[gy]
+		}
+	}
+}
+
+// fillGaps replaces invalid values by the nearest valid one
+func fillGaps(vals []float64, valid []bool) {
+	last := -1
+	for i := range vals {
+		if !valid[i] {
+			continue
+		}
+		// fill preceding gap, splitting it between neighbours
+		for j := last + 1; j < i; j++ {
+			if last >= 0 && j-last < i-j {
+				vals[j] = vals[last]
+			} else {
+				vals[j] = vals[i]
+			}
+		}
+		last = i
+	}
+	if last >= 0 {
+		for j := last + 1; j < len(vals); j++ {
+			vals[j] = vals[last]
+		}
+	}
+}
+
+// morphFilter applies separable min or max filter with square window of
+// half size k to the grid
+func morphFilter(grid []float64, w, h, k int, op func(a, b float64) float64, init float64) []float64 {
+	tmp := make([]float64, len(grid))
+	out := make([]float64, len(grid))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := init
+			for xx := max(x-k, 0); xx <= min(x+k, w-1); xx++ {
+				v = op(v, grid[y*w+xx])
+			}
+			tmp[y*w+x] = v
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := init
+			for yy := max(y-k, 0); yy <= min(y+k, h-1); yy++ {
+				v = op(v, tmp[yy*w+x])
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
+
+// upsampleBlocks bilinearly interpolates block values assigned to block
+// centers to every pixel
+func upsampleBlocks(grid []float64, gw, gh, bs, w, h int) []float64 {
+	out := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		fy := math.Max((float64(y)+0.5)/float64(bs)-0.5, 0)
+		y0 := min(int(fy), gh-1)
+		y1 := min(y0+1, gh-1)
+		wy := fy - float64(y0)
+		for x := 0; x < w; x++ {
+			fx := math.Max((float64(x)+0.5)/float64(bs)-0.5, 0)
+			x0 := min(int(fx), gw-1)
+			x1 := min(x0+1, gw-1)
+			wx := fx - float64(x0)
+			v0 := grid[y0*gw+x0]*(1-wx) + grid[y0*gw+x1]*wx
+			v1 := grid[y1*gw+x0]*(1-wx) + grid[y1*gw+x1]*wx
+			out[y*w+x] = v0*(1-wy) + v1*wy
+		}
+	}
+	return out
+}
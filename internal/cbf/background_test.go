@@ -0,0 +1,54 @@
+package cbf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFillGaps(t *testing.T) {
+	cases := []struct {
+		vals  []float64
+		valid []bool
+		want  []float64
+	}{
+		{[]float64{0, 0, 3, 0, 0, 0, 9, 0}, []bool{false, false, true, false, false, false, true, false},
+			[]float64{3, 3, 3, 3, 9, 9, 9, 9}},
+		{[]float64{1, 0, 5}, []bool{true, false, true}, []float64{1, 5, 5}},
+		{[]float64{1, 2}, []bool{true, true}, []float64{1, 2}},
+		{[]float64{7, 8}, []bool{false, false}, []float64{7, 8}},
+	}
+	for _, c := range cases {
+		vals := append([]float64{}, c.vals...)
+		fillGaps(vals, c.valid)
+		if !reflect.DeepEqual(vals, c.want) {
+			t.Errorf("fillGaps(%v, %v) = %v, expected %v", c.vals, c.valid, vals, c.want)
+		}
+	}
+}
+
+func TestFillGrid(t *testing.T) {
+	// 3x4 grid, the second row is fully masked, the last one has one valid
+	// block, blocks equally distant from two valid ones take the following one
+	grid := []float64{
+		1, 0, 3,
+		0, 0, 0,
+		7, 8, 9,
+		0, 5, 0,
+	}
+	valid := []bool{
+		true, false, true,
+		false, false, false,
+		true, true, true,
+		false, true, false,
+	}
+	fillGrid(grid, valid, 3, 4)
+	want := []float64{
+		1, 3, 3,
+		7, 8, 9,
+		7, 8, 9,
+		5, 5, 5,
+	}
+	if !reflect.DeepEqual(grid, want) {
+		t.Errorf("fillGrid = %v, expected %v", grid, want)
+	}
+}
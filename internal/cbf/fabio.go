@@ -17,10 +17,19 @@ import (
 )
 
 func ReadCBF(path string, verbose int) ([]int32, int, int, error) {
-	data, err := os.ReadFile(path)
+	frame, err := ReadFrame(path, verbose)
 	if err != nil {
 		return nil, 0, 0, err
 	}
+	return frame.Pixels, frame.Width, frame.Height, nil
+}
+
+// ReadFrame reads CBF file and returns decoded frame with its header
+func ReadFrame(path string, verbose int) (*Frame, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 
 	// ------------------------------------------------------------
 	// Locate binary starter
@@ -28,7 +37,7 @@ func ReadCBF(path string, verbose int) ([]int32, int, int, error) {
 	starter := []byte{0x0c, 0x1a, 0x04, 0xd5}
 	pos := bytes.Index(data, starter)
 	if pos < 0 {
-		return nil, 0, 0, fmt.Errorf("CBF binary starter not found")
+		return nil, fmt.Errorf("CBF binary starter not found")
 	}
 
 	headerText := string(data[:pos])
@@ -48,20 +57,20 @@ func ReadCBF(path string, verbose int) ([]int32, int, int, error) {
 	// Dimensions (these ARE present in your file)
 	w, err := strconv.Atoi(header["X-Binary-Size-Fastest-Dimension"])
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 	h, err := strconv.Atoi(header["X-Binary-Size-Second-Dimension"])
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
 	nElem, err := strconv.Atoi(header["X-Binary-Number-of-Elements"])
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
 	if nElem != w*h {
-		return nil, 0, 0, fmt.Errorf("element mismatch: %d vs %d", nElem, w*h)
+		return nil, fmt.Errorf("element mismatch: %d vs %d", nElem, w*h)
 	}
 
 	// ------------------------------------------------------------
@@ -69,11 +78,11 @@ func ReadCBF(path string, verbose int) ([]int32, int, int, error) {
 	// ------------------------------------------------------------
 	binSize, err := strconv.Atoi(header["X-Binary-Size"])
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
 	if binaryStart+binSize > len(data) {
-		return nil, 0, 0, fmt.Errorf("binary data truncated")
+		return nil, fmt.Errorf("binary data truncated")
 	}
 
 	binaryData := data[binaryStart : binaryStart+binSize]
@@ -83,18 +92,80 @@ func ReadCBF(path string, verbose int) ([]int32, int, int, error) {
 	// ------------------------------------------------------------
 	pixels, err := decByteOffsetFabio(binaryData, nElem)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 	if verbose > 0 {
 		fmt.Println("### first 10 pixels", pixels[:10])
 	}
 
-	return pixels, w, h, nil
+	contents := pilatusContents(headerText)
+	frame := &Frame{
+		Pixels:   pixels,
+		Width:    w,
+		Height:   h,
+		Header:   header,
+		Meta:     parsePilatusHeader(contents),
+		Contents: contents,
+		Binary:   binaryData,
+	}
+	return frame, nil
+}
+
+// ReadHeader reads CBF file header without decoding binary data, returned
+// frame has dimensions and header information but no pixels
+func ReadHeader(path string) (*Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// read file until binary starter
+	br := bufio.NewReader(file)
+	var buf bytes.Buffer
+	for !bytes.HasSuffix(buf.Bytes(), starter) {
+		chunk, err := br.ReadSlice(starter[len(starter)-1])
+		buf.Write(chunk)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("CBF binary starter not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headerText := buf.String()[:buf.Len()-len(starter)]
+	header := parseCBFHeader(headerText)
+	w, err := strconv.Atoi(header["X-Binary-Size-Fastest-Dimension"])
+	if err != nil {
+		return nil, err
+	}
+	h, err := strconv.Atoi(header["X-Binary-Size-Second-Dimension"])
+	if err != nil {
+		return nil, err
+	}
+	contents := pilatusContents(headerText)
+	return &Frame{
+		Width:    w,
+		Height:   h,
+		Header:   header,
+		Meta:     parsePilatusHeader(contents),
+		Contents: contents,
+	}, nil
 }
 
 // ------------------------------------------------------------
 // BYTE_OFFSET decoder (Fabio-compatible)
 // ------------------------------------------------------------
+
+// decByteOffsetFabio decodes BYTE_OFFSET compressed pixels. The first pixel
+// is a delta relative to zero and honours 16/32-bit escape codes like all
+// other pixels; earlier versions read it as a bare int8, which misdecoded
+// frames whose first pixel did not fit into int8 and shifted all pixels
+// following it.
 func decByteOffsetFabio(raw []byte, size int) ([]int32, error) {
 	if len(raw) == 0 {
 		return nil, errors.New("empty byte_offset stream")
@@ -104,18 +175,11 @@ func decByteOffsetFabio(raw []byte, size int) ([]int32, error) {
 	r := bytes.NewReader(raw)
 
 	// ------------------------------------------------------------
-	// FIRST pixel: ABSOLUTE int8  (Pilatus / FabIO behavior)
-	// ------------------------------------------------------------
-	var first int8
-	if err := binary.Read(r, binary.LittleEndian, &first); err != nil {
-		return nil, err
-	}
-	out[0] = int32(first)
-
-	// ------------------------------------------------------------
-	// Remaining pixels: BYTE_OFFSET deltas
+	// All pixels are BYTE_OFFSET deltas, the first one is relative
+	// to zero (for small values it is the absolute int8 value)
 	// ------------------------------------------------------------
-	for i := 1; i < size; i++ {
+	var prev int32
+	for i := 0; i < size; i++ {
 		var d8 int8
 		if err := binary.Read(r, binary.LittleEndian, &d8); err != nil {
 			return nil, fmt.Errorf("byte_offset truncated at pixel %d", i)
@@ -139,7 +203,8 @@ func decByteOffsetFabio(raw []byte, size int) ([]int32, error) {
 			}
 		}
 
-		out[i] = out[i-1] + delta
+		out[i] = prev + delta
+		prev = out[i]
 	}
 
 	return out, nil
@@ -0,0 +1,68 @@
+package cbf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestByteOffsetRoundTrip(t *testing.T) {
+	cases := map[string][]int32{
+		"int8 first":     {5, 7, 3, -1, 0},
+		"masked first":   {-1, -2, 10},
+		"int8 limits":    {127, 0, -127, 0},
+		"escaped -128":   {-128, 0},
+		"above int8":     {200, 201, 199},
+		"int16 first":    {30000, 30001, -2, 0},
+		"int16 limits":   {math.MaxInt16, 0, math.MinInt16 + 1, 0},
+		"escaped -32768": {math.MinInt16, 0},
+		"int32 first":    {40000, 40001, 5},
+		"int32 limits":   {math.MaxInt32, 0, math.MinInt32 + 1, 1},
+		"overloaded":     {0, 1048575, 1048574, 0},
+	}
+	for name, pixels := range cases {
+		out, err := decByteOffsetFabio(encByteOffset(pixels), len(pixels))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, pixels) {
+			t.Errorf("%s: decoded %v, expected %v", name, out, pixels)
+		}
+	}
+}
+
+func TestByteOffsetDecode(t *testing.T) {
+	// streams written according to CBF BYTE_OFFSET definition, the first
+	// pixel is a delta relative to zero
+	cases := []struct {
+		name string
+		raw  []byte
+		want []int32
+	}{
+		{"int8", []byte{0x05, 0x02, 0xfc}, []int32{5, 7, 3}},
+		{"int16 first", []byte{0x80, 0xc8, 0x00, 0x01}, []int32{200, 201}},
+		{"int32 first", []byte{0x80, 0x00, 0x80, 0x40, 0x9c, 0x00, 0x00, 0xff}, []int32{40000, 39999}},
+		{"int16 delta", []byte{0x01, 0x80, 0x18, 0xfc}, []int32{1, -999}},
+	}
+	for _, c := range cases {
+		out, err := decByteOffsetFabio(c.raw, len(c.want))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: decoded %v, expected %v", c.name, out, c.want)
+		}
+	}
+
+	if _, err := decByteOffsetFabio([]byte{0x01, 0x80}, 2); err == nil {
+		t.Error("expected error of truncated escape")
+	}
+	if _, err := decByteOffsetFabio([]byte{0x01}, 2); err == nil {
+		t.Error("expected error of truncated stream")
+	}
+	if _, err := decByteOffsetFabio(nil, 1); err == nil {
+		t.Error("expected error of empty stream")
+	}
+}
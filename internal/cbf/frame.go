@@ -0,0 +1,115 @@
+package cbf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Frame represents decoded CBF image together with its header information
+type Frame struct {
+	Pixels []int32
+	Width  int
+	Height int
+	Header map[string]string
+	Meta   Metadata
+	// PILATUS header lines (without leading "# ") of _array_data.header_contents
+	Contents []string
+	// compressed binary section of CBF file, nil for computed frames
+	Binary []byte
+}
+
+// Metadata represents experiment geometry stored in PILATUS-style
+// "# Key value" header lines (_array_data.header_contents section)
+type Metadata struct {
+	Detector         string  `json:"detector,omitempty"`
+	PixelSizeX       float64 `json:"pixel_size_x"`      // meters
+	PixelSizeY       float64 `json:"pixel_size_y"`      // meters
+	Wavelength       float64 `json:"wavelength"`        // Angstrom
+	DetectorDistance float64 `json:"detector_distance"` // meters
+	BeamX            float64 `json:"beam_x"`            // pixels
+	BeamY            float64 `json:"beam_y"`            // pixels
+	StartAngle       float64 `json:"start_angle"`       // degrees
+	AngleIncrement   float64 `json:"angle_increment"`   // degrees
+	ExposureTime     float64 `json:"exposure_time"`     // seconds
+	CountCutoff      int32   `json:"count_cutoff"`      // counts
+}
+
+// HasGeometry reports if metadata contains enough information to map
+// detector pixels to scattering angles
+func (m Metadata) HasGeometry() bool {
+	return m.PixelSizeX > 0 && m.PixelSizeY > 0 && m.DetectorDistance > 0 && m.Wavelength > 0
+}
+
+// Overloaded reports if given pixel value reached detector count cutoff
+func (f *Frame) Overloaded(v int32) bool {
+	return f.Meta.CountCutoff > 0 && v >= f.Meta.CountCutoff
+}
+
+// pilatusContents returns PILATUS header lines of CBF header text without
+// leading "# " marker
+func pilatusContents(txt string) []string {
+	var contents []string
+	for _, line := range strings.Split(txt, "\n") {
+		l := strings.TrimSpace(line)
+		if strings.HasPrefix(l, "# ") {
+			contents = append(contents, strings.TrimSpace(strings.TrimPrefix(l, "#")))
+		}
+	}
+	return contents
+}
+
+// parsePilatusHeader parses PILATUS "Key value unit" header lines, e.g.
+//
+//	Pixel_size 172e-6 m x 172e-6 m
+//	Wavelength 0.97949 A
+//	Beam_xy (1231.50, 1263.50) pixels
+func parsePilatusHeader(contents []string) Metadata {
+	var m Metadata
+	for _, l := range contents {
+		if strings.HasPrefix(l, "Detector:") {
+			m.Detector = strings.TrimSpace(strings.TrimPrefix(l, "Detector:"))
+			continue
+		}
+		// replace separators used in PILATUS headers, e.g. Beam_xy (x, y) or Tau = value
+		fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ", ",", " ", "=", " ", ":", " ").Replace(l))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "Pixel_size":
+			m.PixelSizeX = headerFloat(fields, 1)
+			m.PixelSizeY = m.PixelSizeX
+			if len(fields) >= 5 && fields[3] == "x" {
+				m.PixelSizeY = headerFloat(fields, 4)
+			}
+		case "Wavelength":
+			m.Wavelength = headerFloat(fields, 1)
+		case "Detector_distance":
+			m.DetectorDistance = headerFloat(fields, 1)
+		case "Beam_xy":
+			m.BeamX = headerFloat(fields, 1)
+			m.BeamY = headerFloat(fields, 2)
+		case "Start_angle":
+			m.StartAngle = headerFloat(fields, 1)
+		case "Angle_increment":
+			m.AngleIncrement = headerFloat(fields, 1)
+		case "Exposure_time":
+			m.ExposureTime = headerFloat(fields, 1)
+		case "Count_cutoff":
+			m.CountCutoff = int32(headerFloat(fields, 1))
+		}
+	}
+	return m
+}
+
+// headerFloat returns float value of given field or zero if it can't be parsed
+func headerFloat(fields []string, idx int) float64 {
+	if idx >= len(fields) {
+		return 0
+	}
+	v, err := strconv.ParseFloat(fields[idx], 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
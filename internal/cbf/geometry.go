@@ -0,0 +1,101 @@
+package cbf
+
+import (
+	"fmt"
+	"math"
+)
+
+// Unit represents radial coordinate used to bin detector pixels
+type Unit string
+
+const (
+	UnitRadius   Unit = "r"      // distance from beam center in pixels
+	UnitQ        Unit = "q"      // scattering vector 4*pi*sin(theta)/lambda in 1/Angstrom
+	UnitTwoTheta Unit = "2theta" // scattering angle in degrees
+	UnitD        Unit = "d"      // resolution (d-spacing) in Angstrom
+)
+
+// ParseUnit converts string to radial unit
+func ParseUnit(s string) (Unit, error) {
+	switch Unit(s) {
+	case UnitRadius, UnitQ, UnitTwoTheta, UnitD:
+		return Unit(s), nil
+	case "radius":
+		return UnitRadius, nil
+	case "resolution":
+		return UnitD, nil
+	}
+	return "", fmt.Errorf("unsupported unit %q, should be one of r, q, 2theta, d", s)
+}
+
+// BeamCenter returns beam center in pixels, if header does not provide it
+// the center of the detector is used
+func (f *Frame) BeamCenter() (float64, float64) {
+	if f.Meta.BeamX == 0 && f.Meta.BeamY == 0 {
+		return float64(f.Width) / 2, float64(f.Height) / 2
+	}
+	return f.Meta.BeamX, f.Meta.BeamY
+}
+
+// Radius returns distance of pixel center from beam center in pixels
+func (f *Frame) Radius(x, y int) float64 {
+	bx, by := f.BeamCenter()
+	return math.Hypot(float64(x)+0.5-bx, float64(y)+0.5-by)
+}
+
+// TwoTheta returns scattering angle of pixel center in radians
+func (f *Frame) TwoTheta(x, y int) float64 {
+	bx, by := f.BeamCenter()
+	dx := (float64(x) + 0.5 - bx) * f.Meta.PixelSizeX
+	dy := (float64(y) + 0.5 - by) * f.Meta.PixelSizeY
+	return math.Atan2(math.Hypot(dx, dy), f.Meta.DetectorDistance)
+}
+
+// Q returns scattering vector length of pixel center in 1/Angstrom
+func (f *Frame) Q(x, y int) float64 {
+	return TwoThetaToQ(f.TwoTheta(x, y), f.Meta.Wavelength)
+}
+
+// Resolution returns d-spacing of pixel center in Angstrom
+func (f *Frame) Resolution(x, y int) float64 {
+	return QToD(f.Q(x, y))
+}
+
+// TwoThetaToQ converts scattering angle (radians) to q (1/Angstrom)
+func TwoThetaToQ(tth, wavelength float64) float64 {
+	return 4 * math.Pi * math.Sin(tth/2) / wavelength
+}
+
+// QToD converts q (1/Angstrom) to d-spacing (Angstrom)
+func QToD(q float64) float64 {
+	if q <= 0 {
+		return math.Inf(1)
+	}
+	return 2 * math.Pi / q
+}
+
+// DToQ converts d-spacing (Angstrom) to q (1/Angstrom)
+func DToQ(d float64) float64 {
+	if d <= 0 {
+		return math.Inf(1)
+	}
+	return 2 * math.Pi / d
+}
+
+// radialCoordinate returns function which computes pixel coordinate in
+// a given unit. For UnitD pixels are binned in q, i.e. uniformly in
+// reciprocal space, and converted to d-spacing on output.
+func radialCoordinate(f *Frame, unit Unit) (func(x, y int) float64, error) {
+	if unit != UnitRadius && !f.Meta.HasGeometry() {
+		return nil, fmt.Errorf("frame header does not provide geometry (pixel size, distance, wavelength) required for unit %q", unit)
+	}
+	switch unit {
+	case UnitRadius:
+		return f.Radius, nil
+	case UnitTwoTheta:
+		return func(x, y int) float64 { return f.TwoTheta(x, y) * 180 / math.Pi }, nil
+	case UnitQ, UnitD:
+		return f.Q, nil
+	}
+	return nil, fmt.Errorf("unsupported unit %q", unit)
+}
@@ -0,0 +1,140 @@
+package cbf
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// size of downsampled image used by perceptual hash
+var phashSize = 32
+
+// NearDuplicateDistance is maximum Hamming distance of perceptual hashes of
+// near-duplicate frames
+const NearDuplicateDistance = 4
+
+// ContentHash returns hex encoded SHA-256 of CBF binary section, i.e. hash
+// of pixel data which does not depend on file name or header. For computed
+// frames without binary section the hash of little-endian pixels is used.
+func ContentHash(f *Frame) string {
+	if f.Binary != nil {
+		sum := sha256.Sum256(f.Binary)
+		return hex.EncodeToString(sum[:])
+	}
+	h := sha256.New()
+	buf := make([]byte, 4*len(f.Pixels))
+	for i, v := range f.Pixels {
+		binary.LittleEndian.PutUint32(buf[4*i:], uint32(v))
+	}
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FrameHash returns hex encoded SHA-256 of frame pixels, dimensions and
+// metadata, i.e. of everything that affects frame analysis. Unlike
+// ContentHash it changes when pixels are modified, e.g. by masking.
+func FrameHash(f *Frame) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%dx%d|%+v|", f.Width, f.Height, f.Meta)
+	buf := make([]byte, 4*len(f.Pixels))
+	for i, v := range f.Pixels {
+		binary.LittleEndian.PutUint32(buf[4*i:], uint32(v))
+	}
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PerceptualHash returns 64-bit DCT perceptual hash of a frame. Frame is
+// downsampled to 32x32 block means of log(1+counts) over unmasked pixels,
+// and every bit of the hash tells if low frequency DCT coefficient is above
+// median. Similar frames have hashes with small Hamming distance.
+func PerceptualHash(f *Frame, mask Mask) uint64 {
+	mask = maskOrDefault(f, mask)
+	n := phashSize
+	small := make([]float64, n*n)
+	counts := make([]int, n*n)
+	for y := 0; y < f.Height; y++ {
+		by := y * n / f.Height
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			if mask[i] {
+				continue
+			}
+			j := by*n + x*n/f.Width
+			small[j] += math.Log1p(float64(f.Pixels[i]))
+			counts[j]++
+		}
+	}
+	for i := range small {
+		if counts[i] > 0 {
+			small[i] /= float64(counts[i])
+		}
+	}
+
+	// low frequency 8x8 block of 2D DCT-II, DC term is skipped
+	coeffs := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				cy := math.Cos(float64((2*y+1)*v) * math.Pi / float64(2*n))
+				for x := 0; x < n; x++ {
+					sum += small[y*n+x] * cy * math.Cos(float64((2*x+1)*u)*math.Pi/float64(2*n))
+				}
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+	sorted := slices.Clone(coeffs[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coeffs {
+		if i > 0 && c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// FormatHash returns hex representation of perceptual hash
+func FormatHash(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+// ParseHash converts hex representation to perceptual hash
+func ParseHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// HammingDistance returns number of different bits of two perceptual hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// HashBands splits perceptual hash into n bands of consecutive bits and
+// returns them as "index:hex" keys. Hashes within Hamming distance n-1 share
+// at least one band, so bands are used to look up near-duplicate candidates
+// which are verified by HammingDistance.
+func HashBands(h uint64, n int) []string {
+	n = min(max(n, 1), 64)
+	bands := make([]string, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		// the first 64%n bands take one extra bit
+		width := 64 / n
+		if i < 64%n {
+			width++
+		}
+		band := (h >> uint(start)) & (1<<uint(width) - 1)
+		bands = append(bands, fmt.Sprintf("%d:%x", i, band))
+		start += width
+	}
+	return bands
+}
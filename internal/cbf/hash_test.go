@@ -0,0 +1,52 @@
+package cbf
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestHashRoundTrip(t *testing.T) {
+	h := uint64(0xdeadbeef01234567)
+	s := FormatHash(h)
+	if len(s) != 16 {
+		t.Errorf("unexpected hash format %q", s)
+	}
+	if p, err := ParseHash(s); err != nil || p != h {
+		t.Errorf("ParseHash(%q) = %x, %v", s, p, err)
+	}
+	if d := HammingDistance(h, h^0b1011); d != 3 {
+		t.Errorf("expected distance 3, got %d", d)
+	}
+}
+
+func TestHashBands(t *testing.T) {
+	n := NearDuplicateDistance + 1
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a := rng.Uint64()
+		// flip up to NearDuplicateDistance random bits
+		b := a
+		for _, bit := range rng.Perm(64)[:rng.Intn(NearDuplicateDistance+1)] {
+			b ^= 1 << uint(bit)
+		}
+		ba, bb := HashBands(a, n), HashBands(b, n)
+		if len(ba) != n {
+			t.Fatalf("expected %d bands, got %v", n, ba)
+		}
+		shared := false
+		for _, band := range ba {
+			shared = shared || slices.Contains(bb, band)
+		}
+		if !shared {
+			t.Fatalf("hashes %x and %x within distance %d share no band", a, b, HammingDistance(a, b))
+		}
+	}
+	// bands of distant hashes differ
+	if a, b := HashBands(0, n), HashBands(^uint64(0), n); slices.ContainsFunc(a, func(s string) bool { return slices.Contains(b, s) }) {
+		t.Errorf("complementary hashes share bands %v %v", a, b)
+	}
+	if bands := HashBands(0xff, 1); len(bands) != 1 || bands[0] != "0:ff" {
+		t.Errorf("unexpected single band %v", bands)
+	}
+}
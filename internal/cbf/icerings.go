@@ -0,0 +1,143 @@
+package cbf
+
+import (
+	"fmt"
+	"math"
+)
+
+// IceRingSpacings represents d-spacings (Angstrom) of hexagonal ice (Ih) powder rings
+var IceRingSpacings = []float64{3.897, 3.669, 3.441, 2.671, 2.249, 2.072, 1.948, 1.918, 1.883, 1.721}
+
+// IceRing represents detection result for single ice ring
+type IceRing struct {
+	D     float64 `json:"d"`     // ring d-spacing in Angstrom
+	Q     float64 `json:"q"`     // ring position in 1/Angstrom
+	Score float64 `json:"score"` // peak height over local background in units of background noise
+	Iced  bool    `json:"iced"`  // score is above detection threshold
+}
+
+// IceResult represents ice ring detection result of a frame
+type IceResult struct {
+	Rings  []IceRing `json:"rings"`   // rings within detector resolution range
+	Score  float64   `json:"score"`   // maximum ring score
+	NRings int       `json:"n_rings"` // number of detected rings
+	Iced   bool      `json:"iced"`    // frame has ice rings
+}
+
+// IceParams represents parameters of ice ring detection
+type IceParams struct {
+	BinWidth  float64 `json:"bin_width"`  // width of profile bins in 1/Angstrom
+	HalfWidth float64 `json:"half_width"` // half width of ring window in 1/Angstrom
+	Threshold float64 `json:"threshold"`  // minimum score of detected ring
+	MinRings  int     `json:"min_rings"`  // minimum number of detected rings to flag the frame
+}
+
+// DefaultIceParams returns default ice ring detection parameters
+func DefaultIceParams() IceParams {
+	return IceParams{
+		BinWidth:  0.002,
+		HalfWidth: 0.012,
+		Threshold: 5,
+		MinRings:  1,
+	}
+}
+
+// DetectIceRings computes azimuthal profile of a frame in q and scores ice
+// rings on it. If mask is nil the frame default mask is used.
+func DetectIceRings(f *Frame, mask Mask, p IceParams) (*IceResult, error) {
+	if p.BinWidth <= 0 {
+		p.BinWidth = DefaultIceParams().BinWidth
+	}
+	// q range of ice rings with enough margin for background windows
+	qmin := DToQ(IceRingSpacings[0]) - 4*p.HalfWidth
+	qmax := DToQ(IceRingSpacings[len(IceRingSpacings)-1]) + 4*p.HalfWidth
+	nbins := int(math.Ceil((qmax - qmin) / p.BinWidth))
+	prof, err := Integrate(f, mask, IntegrateParams{Unit: UnitQ, Bins: nbins, Min: qmin, Max: qmax})
+	if err != nil {
+		return nil, err
+	}
+	return DetectIceRingsInProfile(prof, p)
+}
+
+// DetectIceRingsInProfile scores ice rings on azimuthal profile in q units.
+// For every ring a linear background is fitted to profile bins on both
+// sides of the ring window (excluding windows of other rings) and the score
+// is the maximum excess of the ring bins over the background divided by
+// the background noise.
+func DetectIceRingsInProfile(prof *Profile, p IceParams) (*IceResult, error) {
+	if prof.Unit != UnitQ {
+		return nil, fmt.Errorf("ice ring detection requires profile in q units, got %q", prof.Unit)
+	}
+	inRing := func(q float64) bool {
+		for _, d := range IceRingSpacings {
+			if math.Abs(q-DToQ(d)) <= p.HalfWidth {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := &IceResult{}
+	for _, d := range IceRingSpacings {
+		q0 := DToQ(d)
+		var bq, bv []float64 // background bins
+		var peak []ProfileBin
+		for _, b := range prof.Bins {
+			if b.Count == 0 {
+				continue
+			}
+			dq := math.Abs(b.Center - q0)
+			switch {
+			case dq <= p.HalfWidth:
+				peak = append(peak, b)
+			case dq <= 3*p.HalfWidth && !inRing(b.Center):
+				bq = append(bq, b.Center)
+				bv = append(bv, b.Mean)
+			}
+		}
+		// skip rings outside of detector or without background estimate
+		if len(peak) == 0 || len(bq) < 3 {
+			continue
+		}
+		a, s := linearFit(bq, bv)
+		var resid float64
+		for i := range bq {
+			r := bv[i] - (a + s*bq[i])
+			resid += r * r
+		}
+		sigma := math.Sqrt(resid / float64(len(bq)-2))
+		ring := IceRing{D: d, Q: q0}
+		for _, b := range peak {
+			bg := a + s*b.Center
+			// background noise can't be below Poisson noise of the bin mean
+			noise := math.Max(sigma, math.Sqrt(math.Max(bg, 1)/float64(b.Count)))
+			ring.Score = math.Max(ring.Score, (b.Mean-bg)/noise)
+		}
+		ring.Iced = ring.Score >= p.Threshold
+		if ring.Iced {
+			res.NRings++
+		}
+		res.Score = math.Max(res.Score, ring.Score)
+		res.Rings = append(res.Rings, ring)
+	}
+	res.Iced = res.NRings > 0 && res.NRings >= p.MinRings
+	return res, nil
+}
+
+// linearFit returns intercept and slope of least squares line fit
+func linearFit(x, y []float64) (float64, float64) {
+	n := float64(len(x))
+	var sx, sy, sxx, sxy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		sxy += x[i] * y[i]
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return sy / n, 0
+	}
+	slope := (n*sxy - sx*sy) / den
+	return (sy - slope*sx) / n, slope
+}
@@ -0,0 +1,106 @@
+package cbf
+
+import (
+	"fmt"
+	"math"
+)
+
+// ProfileBin represents single bin of azimuthally integrated profile
+type ProfileBin struct {
+	Center float64 `json:"center"` // bin center in profile unit
+	Low    float64 `json:"low"`    // lower edge of the bin in profile unit
+	High   float64 `json:"high"`   // upper edge of the bin in profile unit
+	Sum    float64 `json:"sum"`    // sum of pixel counts
+	Count  int     `json:"count"`  // number of pixels
+	Mean   float64 `json:"mean"`   // average pixel counts
+}
+
+// Profile represents azimuthally averaged 1D intensity profile
+type Profile struct {
+	Unit Unit         `json:"unit"`
+	Bins []ProfileBin `json:"bins"`
+}
+
+// IntegrateParams represents parameters of azimuthal integration
+type IntegrateParams struct {
+	Unit Unit    `json:"unit"`
+	Bins int     `json:"bins"`
+	Min  float64 `json:"min"` // lower limit of radial range in q units for UnitD, zero means auto
+	Max  float64 `json:"max"` // upper limit of radial range in q units for UnitD, zero means auto
+}
+
+// default number of bins of azimuthal integration
+var DefaultIntegrateBins = 500
+
+// Integrate bins unmasked frame pixels by radial coordinate and returns
+// azimuthally averaged profile. If mask is nil the frame default mask is used.
+// For UnitD bins are uniform in q and ordered from low to high resolution.
+func Integrate(f *Frame, mask Mask, p IntegrateParams) (*Profile, error) {
+	mask = maskOrDefault(f, mask)
+	if p.Bins <= 0 {
+		p.Bins = DefaultIntegrateBins
+	}
+	if p.Unit == "" {
+		p.Unit = UnitRadius
+	}
+	coord, err := radialCoordinate(f, p.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	// compute pixel coordinates and radial range
+	rad := make([]float64, len(f.Pixels))
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			if mask[i] {
+				continue
+			}
+			r := coord(x, y)
+			rad[i] = r
+			if p.Unit == UnitD && r <= 0 {
+				// pixel at beam center has infinite d-spacing
+				continue
+			}
+			lo = math.Min(lo, r)
+			hi = math.Max(hi, r)
+		}
+	}
+	if p.Min > 0 {
+		lo = p.Min
+	}
+	if p.Max > 0 {
+		hi = p.Max
+	}
+	if math.IsInf(lo, 0) || hi <= lo {
+		return nil, fmt.Errorf("invalid radial range: lo=%f hi=%f", lo, hi)
+	}
+
+	step := (hi - lo) / float64(p.Bins)
+	prof := &Profile{Unit: p.Unit, Bins: make([]ProfileBin, p.Bins)}
+	for i, v := range f.Pixels {
+		if mask[i] || rad[i] < lo || rad[i] > hi {
+			continue
+		}
+		idx := int((rad[i] - lo) / step)
+		if idx >= p.Bins {
+			idx = p.Bins - 1
+		}
+		prof.Bins[idx].Sum += float64(v)
+		prof.Bins[idx].Count++
+	}
+	for i := range prof.Bins {
+		b := &prof.Bins[i]
+		b.Low = lo + float64(i)*step
+		b.High = b.Low + step
+		b.Center = b.Low + step/2
+		if b.Count > 0 {
+			b.Mean = b.Sum / float64(b.Count)
+		}
+		if p.Unit == UnitD {
+			b.Low, b.High, b.Center = QToD(b.High), QToD(b.Low), QToD(b.Center)
+		}
+	}
+	return prof, nil
+}
@@ -0,0 +1,122 @@
+package cbf
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// Mask represents per-pixel mask of the frame, true values mark pixels
+// which should be excluded from analysis
+type Mask []bool
+
+// DefaultMask returns mask of detector gaps and bad pixels, i.e. pixels
+// with negative values (PILATUS uses -1 for gaps and -2 for bad pixels)
+func (f *Frame) DefaultMask() Mask {
+	mask := make(Mask, len(f.Pixels))
+	for i, v := range f.Pixels {
+		mask[i] = v < 0
+	}
+	return mask
+}
+
+// Count returns number of masked pixels
+func (m Mask) Count() int {
+	n := 0
+	for _, v := range m {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// maskOrDefault returns given mask or default frame mask if it is not provided
+func maskOrDefault(f *Frame, mask Mask) Mask {
+	if len(mask) != len(f.Pixels) {
+		return f.DefaultMask()
+	}
+	return mask
+}
+
+// Merge returns union of two masks of the same size
+func (m Mask) Merge(other Mask) Mask {
+	out := make(Mask, len(m))
+	for i := range m {
+		out[i] = m[i] || (i < len(other) && other[i])
+	}
+	return out
+}
+
+// ApplyMask sets masked pixels of the frame to given value, e.g. MaskedValue
+// to treat them as detector gaps
+func (f *Frame) ApplyMask(mask Mask, value int32) error {
+	if len(mask) != len(f.Pixels) {
+		return fmt.Errorf("mask size mismatch: %d vs %d", len(mask), len(f.Pixels))
+	}
+	for i, m := range mask {
+		if m {
+			f.Pixels[i] = value
+		}
+	}
+	return nil
+}
+
+// WriteMask writes mask to grayscale PNG file, masked pixels are white
+func WriteMask(path string, mask Mask, w, h int) error {
+	if len(mask) != w*h {
+		return fmt.Errorf("mask size mismatch: %d vs %d", len(mask), w*h)
+	}
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i, m := range mask {
+		if m {
+			img.Pix[i] = 255
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ReadMask reads mask from PNG file written by WriteMask, any non-black
+// pixel is treated as masked. It returns mask and its dimensions.
+func ReadMask(path string) (Mask, int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	mask := make(Mask, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			mask[y*w+x] = r|g|bl != 0
+		}
+	}
+	return mask, w, h, nil
+}
+
+// LoadMask reads mask file and checks that it matches frame dimensions
+func LoadMask(path string, f *Frame) (Mask, error) {
+	mask, w, h, err := ReadMask(path)
+	if err != nil {
+		return nil, err
+	}
+	if w != f.Width || h != f.Height {
+		return nil, fmt.Errorf("mask %s size %dx%d does not match frame size %dx%d", path, w, h, f.Width, f.Height)
+	}
+	return mask, nil
+}
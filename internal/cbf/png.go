@@ -32,8 +32,28 @@ func viridis(t float64) color.RGBA {
 }
 
 func WritePNGColor(pixels []int32, w, h int, outPath string) error {
+	img, err := ColorImage(pixels, w, h)
+	if err != nil {
+		return err
+	}
+
+	// ------------------------------------------------------------
+	// Write PNG
+	// ------------------------------------------------------------
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// ColorImage renders pixels to RGBA image using viridis color map with
+// percentile clipping
+func ColorImage(pixels []int32, w, h int) (*image.RGBA, error) {
 	if len(pixels) != w*h {
-		return fmt.Errorf("pixel count mismatch: %d vs %d", len(pixels), w*h)
+		return nil, fmt.Errorf("pixel count mismatch: %d vs %d", len(pixels), w*h)
 	}
 
 	// ------------------------------------------------------------
@@ -55,7 +75,7 @@ func WritePNGColor(pixels []int32, w, h int, outPath string) error {
 	hi := percentile(vals, 99.5)
 
 	if hi <= lo {
-		return fmt.Errorf("invalid clip range: lo=%f hi=%f", lo, hi)
+		return nil, fmt.Errorf("invalid clip range: lo=%f hi=%f", lo, hi)
 	}
 
 	scale := 1.0 / (hi - lo)
@@ -81,17 +101,7 @@ func WritePNGColor(pixels []int32, w, h int, outPath string) error {
 			img.SetRGBA(x, y, viridis(t))
 		}
 	}
-
-	// ------------------------------------------------------------
-	// Write PNG
-	// ------------------------------------------------------------
-	f, err := os.Create(outPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	return png.Encode(f, img)
+	return img, nil
 }
 
 func WritePNG(pixels []int32, w, h int, outPath string) error {
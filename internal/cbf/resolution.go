@@ -0,0 +1,85 @@
+package cbf
+
+import (
+	"fmt"
+	"math"
+)
+
+// ResolutionParams represents parameters of resolution limit estimation
+type ResolutionParams struct {
+	Shells           int `json:"shells"`              // number of resolution shells of equal reciprocal volume
+	MinSpots         int `json:"min_spots"`           // minimum number of spots to estimate resolution
+	MinSpotsPerShell int `json:"min_spots_per_shell"` // minimum number of spots in a shell which diffracts
+}
+
+// DefaultResolutionParams returns default resolution estimation parameters
+func DefaultResolutionParams() ResolutionParams {
+	return ResolutionParams{
+		Shells:           20,
+		MinSpots:         10,
+		MinSpotsPerShell: 2,
+	}
+}
+
+// EstimateResolution estimates resolution limit (Angstrom) of a frame from
+// positions of strong spots. Spots are binned in shells equally spaced in
+// 1/d^2 up to the detector edge and the limit is the outer edge of the last
+// shell with enough spots before two consecutive weak shells. It returns
+// zero if frame has too few spots, i.e. no diffraction.
+func EstimateResolution(f *Frame, spots []Spot, p ResolutionParams) (float64, error) {
+	if !f.Meta.HasGeometry() {
+		return 0, fmt.Errorf("frame header does not provide geometry required for resolution estimate")
+	}
+	if p.Shells <= 0 {
+		p.Shells = DefaultResolutionParams().Shells
+	}
+	if len(spots) < p.MinSpots {
+		return 0, nil
+	}
+
+	// maximum 1/d^2 is reached at one of detector corners
+	var smax float64
+	for _, c := range [][2]int{{0, 0}, {f.Width - 1, 0}, {0, f.Height - 1}, {f.Width - 1, f.Height - 1}} {
+		smax = math.Max(smax, invD2(f.Q(c[0], c[1])))
+	}
+	if smax <= 0 {
+		return 0, fmt.Errorf("invalid detector resolution range")
+	}
+
+	counts := make([]int, p.Shells)
+	bx, by := f.BeamCenter()
+	for _, s := range spots {
+		dx := (s.X - bx) * f.Meta.PixelSizeX
+		dy := (s.Y - by) * f.Meta.PixelSizeY
+		q := TwoThetaToQ(math.Atan2(math.Hypot(dx, dy), f.Meta.DetectorDistance), f.Meta.Wavelength)
+		idx := int(invD2(q) / smax * float64(p.Shells))
+		if idx >= p.Shells {
+			idx = p.Shells - 1
+		}
+		counts[idx]++
+	}
+
+	last, weak := -1, 0
+	for i, n := range counts {
+		if n >= p.MinSpotsPerShell {
+			last, weak = i, 0
+			continue
+		}
+		weak++
+		// allow a single weak shell, e.g. due to ice ring or module gap
+		if last >= 0 && weak >= 2 {
+			break
+		}
+	}
+	if last < 0 {
+		return 0, nil
+	}
+	edge := smax * float64(last+1) / float64(p.Shells)
+	return 1 / math.Sqrt(edge), nil
+}
+
+// invD2 converts q (1/Angstrom) to 1/d^2
+func invD2(q float64) float64 {
+	d := QToD(q)
+	return 1 / (d * d)
+}
@@ -0,0 +1,172 @@
+package cbf
+
+import (
+	"math"
+	"slices"
+)
+
+// ShadowParams represents parameters of beamstop and shadow detection
+type ShadowParams struct {
+	BlockSize    int     `json:"block_size"`    // size of pixel blocks used to suppress counting noise
+	Threshold    float64 `json:"threshold"`     // block is shadowed if its mean is below Threshold * radial median
+	CenterRadius float64 `json:"center_radius"` // shadow regions must reach this distance (pixels) from beam center
+	Dilate       int     `json:"dilate"`        // number of pixels to grow the shadow mask by
+}
+
+// DefaultShadowParams returns default shadow detection parameters
+func DefaultShadowParams() ShadowParams {
+	return ShadowParams{
+		BlockSize:    4,
+		Threshold:    0.3,
+		CenterRadius: 50,
+		Dilate:       2,
+	}
+}
+
+// DetectShadow finds beamstop and beamstop arm shadows on a frame (or on a
+// sum of sweep frames which has better statistics). Frame is divided into
+// blocks and a block is a shadow candidate if its mean counts is well below
+// the median of blocks at the same distance from the beam center.
+// Connected regions of candidate blocks which reach the beam center area
+// (beamstop and the arm attached to it) form the shadow mask. If mask is nil
+// the frame default mask is used, returned mask contains shadow pixels only.
+func DetectShadow(f *Frame, mask Mask, p ShadowParams) Mask {
+	mask = maskOrDefault(f, mask)
+	bs := max(p.BlockSize, 1)
+	bw, bh := (f.Width+bs-1)/bs, (f.Height+bs-1)/bs
+
+	// block means of unmasked pixels
+	sums := make([]float64, bw*bh)
+	counts := make([]int, bw*bh)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			if mask[i] {
+				continue
+			}
+			j := (y/bs)*bw + x/bs
+			sums[j] += float64(f.Pixels[i])
+			counts[j]++
+		}
+	}
+
+	// radial median of block means, radius in block units
+	bx, by := f.BeamCenter()
+	radius := func(j int) int {
+		cx := (float64(j%bw) + 0.5) * float64(bs)
+		cy := (float64(j/bw) + 0.5) * float64(bs)
+		return int(math.Hypot(cx-bx, cy-by) / float64(bs))
+	}
+	rings := make(map[int][]float64)
+	for j := range sums {
+		if counts[j] > 0 {
+			sums[j] /= float64(counts[j])
+			r := radius(j)
+			rings[r] = append(rings[r], sums[j])
+		}
+	}
+	medians := make(map[int]float64, len(rings))
+	maxR := 0
+	for r, vals := range rings {
+		slices.Sort(vals)
+		medians[r] = vals[len(vals)/2]
+		maxR = max(maxR, r)
+	}
+
+	// smooth ring medians over neighbouring rings to suppress narrow
+	// features like ice or powder rings
+	smooth := make(map[int]float64, len(medians))
+	var window []float64
+	for r := 0; r <= maxR; r++ {
+		window = window[:0]
+		for rr := r - 3; rr <= r+3; rr++ {
+			if v, ok := medians[rr]; ok {
+				window = append(window, v)
+			}
+		}
+		if len(window) > 0 {
+			slices.Sort(window)
+			smooth[r] = window[len(window)/2]
+		}
+	}
+
+	// reference level of a ring is the largest smoothed median within
+	// center radius further out, since close to the center the beamstop
+	// may cover whole rings
+	reach := int(math.Ceil(p.CenterRadius / float64(bs)))
+	reference := func(r int) float64 {
+		var ref float64
+		for rr := r; rr <= r+reach; rr++ {
+			ref = math.Max(ref, smooth[rr])
+		}
+		return ref
+	}
+
+	// shadow candidates
+	candidate := make([]bool, bw*bh)
+	for j := range sums {
+		if counts[j] == 0 {
+			continue
+		}
+		ref := reference(radius(j))
+		candidate[j] = ref > 0 && sums[j] < p.Threshold*ref
+	}
+
+	// keep connected regions which reach the beam center area
+	shadow := make([]bool, bw*bh)
+	visited := make([]bool, bw*bh)
+	var stack, region []int
+	for j := range candidate {
+		if !candidate[j] || visited[j] {
+			continue
+		}
+		stack = append(stack[:0], j)
+		region = region[:0]
+		visited[j] = true
+		central := false
+		for len(stack) > 0 {
+			k := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			region = append(region, k)
+			if float64(radius(k)*bs) <= p.CenterRadius {
+				central = true
+			}
+			kx, ky := k%bw, k/bw
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := kx+dx, ky+dy
+					if nx < 0 || ny < 0 || nx >= bw || ny >= bh {
+						continue
+					}
+					n := ny*bw + nx
+					if candidate[n] && !visited[n] {
+						visited[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		if central {
+			for _, k := range region {
+				shadow[k] = true
+			}
+		}
+	}
+
+	// expand blocks to pixels and dilate the mask
+	out := make(Mask, len(f.Pixels))
+	d := p.Dilate
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			if !shadow[(y/bs)*bw+x/bs] {
+				continue
+			}
+			for yy := max(y-d, 0); yy <= min(y+d, f.Height-1); yy++ {
+				for xx := max(x-d, 0); xx <= min(x+d, f.Width-1); xx++ {
+					out[yy*f.Width+xx] = true
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package cbf
+
+import (
+	"math"
+)
+
+// Spot represents strong (Bragg) spot found on a frame
+type Spot struct {
+	X         float64 `json:"x"`         // intensity weighted centroid, fast axis (pixels)
+	Y         float64 `json:"y"`         // intensity weighted centroid, slow axis (pixels)
+	Intensity int64   `json:"intensity"` // sum of spot pixel counts
+	Peak      int32   `json:"peak"`      // maximum pixel count
+	Size      int     `json:"size"`      // number of spot pixels
+}
+
+// SpotParams represents parameters of dispersion spot finder, see
+// DIALS spotfinder.threshold.dispersion for their meaning
+type SpotParams struct {
+	KernelSize      int     `json:"kernel_size"`      // half size of local window, i.e. 3 means 7x7 window
+	SigmaBackground float64 `json:"sigma_background"` // dispersion (variance/mean) threshold
+	SigmaStrong     float64 `json:"sigma_strong"`     // pixel over local mean threshold
+	GlobalThreshold float64 `json:"global_threshold"` // minimum pixel value
+	MinLocal        int     `json:"min_local"`        // minimum number of valid pixels in local window
+	MinSpotSize     int     `json:"min_spot_size"`    // minimum number of pixels in a spot
+	MaxSpotSize     int     `json:"max_spot_size"`    // maximum number of pixels in a spot (0 means no limit)
+}
+
+// DefaultSpotParams returns DIALS-like default spot finder parameters
+func DefaultSpotParams() SpotParams {
+	return SpotParams{
+		KernelSize:      3,
+		SigmaBackground: 6,
+		SigmaStrong:     3,
+		GlobalThreshold: 0,
+		MinLocal:        2,
+		MinSpotSize:     3,
+		MaxSpotSize:     1000,
+	}
+}
+
+// FindSpots finds strong spots on a frame using dispersion threshold
+// algorithm: a pixel is strong if its local window is not Poisson-like
+// (variance/mean is above 1 + SigmaBackground*sqrt(2/(n-1))) and the pixel
+// itself is above local mean + SigmaStrong*sqrt(mean). Strong pixels are
+// grouped into 8-connected spots. If mask is nil the frame default mask is used.
+func FindSpots(f *Frame, mask Mask, p SpotParams) []Spot {
+	strong := StrongPixels(f, mask, p)
+	return labelSpots(f, strong, p)
+}
+
+// StrongPixels returns mask of strong pixels of dispersion threshold algorithm
+func StrongPixels(f *Frame, mask Mask, p SpotParams) []bool {
+	mask = maskOrDefault(f, mask)
+	w, h, k := f.Width, f.Height, p.KernelSize
+	strong := make([]bool, len(f.Pixels))
+	if k <= 0 || w == 0 || h == 0 {
+		return strong
+	}
+
+	// running column sums over window rows [y-k, y+k]
+	colN := make([]int, w)
+	colS := make([]float64, w)
+	colS2 := make([]float64, w)
+	addRow := func(y int, sign int) {
+		if y < 0 || y >= h {
+			return
+		}
+		row := y * w
+		for x := 0; x < w; x++ {
+			if mask[row+x] {
+				continue
+			}
+			v := float64(f.Pixels[row+x])
+			colN[x] += sign
+			colS[x] += float64(sign) * v
+			colS2[x] += float64(sign) * v * v
+		}
+	}
+	for y := 0; y < k; y++ {
+		addRow(y, 1)
+	}
+
+	for y := 0; y < h; y++ {
+		addRow(y+k, 1)
+		addRow(y-k-1, -1)
+
+		// sliding window along the row over column sums
+		n, s, s2 := 0, 0.0, 0.0
+		for x := 0; x < k && x < w; x++ {
+			n += colN[x]
+			s += colS[x]
+			s2 += colS2[x]
+		}
+		row := y * w
+		for x := 0; x < w; x++ {
+			if x+k < w {
+				n += colN[x+k]
+				s += colS[x+k]
+				s2 += colS2[x+k]
+			}
+			if x-k-1 >= 0 {
+				n -= colN[x-k-1]
+				s -= colS[x-k-1]
+				s2 -= colS2[x-k-1]
+			}
+			if mask[row+x] || n < p.MinLocal || n < 2 {
+				continue
+			}
+			v := float64(f.Pixels[row+x])
+			if v <= p.GlobalThreshold {
+				continue
+			}
+			fn := float64(n)
+			mean := s / fn
+			if mean <= 0 {
+				continue
+			}
+			variance := (s2 - s*s/fn) / (fn - 1)
+			if variance/mean <= 1+p.SigmaBackground*math.Sqrt(2/(fn-1)) {
+				continue
+			}
+			if v <= mean+p.SigmaStrong*math.Sqrt(mean) {
+				continue
+			}
+			strong[row+x] = true
+		}
+	}
+	return strong
+}
+
+// labelSpots groups strong pixels into 8-connected spots
+func labelSpots(f *Frame, strong []bool, p SpotParams) []Spot {
+	w, h := f.Width, f.Height
+	visited := make([]bool, len(strong))
+	var spots []Spot
+	var stack []int
+	for i, s := range strong {
+		if !s || visited[i] {
+			continue
+		}
+		var spot Spot
+		var sx, sy, sw float64
+		stack = append(stack[:0], i)
+		visited[i] = true
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := j%w, j/w
+			v := f.Pixels[j]
+			spot.Size++
+			spot.Intensity += int64(v)
+			if v > spot.Peak {
+				spot.Peak = v
+			}
+			// use pixel centers for centroid
+			wt := math.Max(float64(v), 0)
+			sx += wt * (float64(x) + 0.5)
+			sy += wt * (float64(y) + 0.5)
+			sw += wt
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					nj := ny*w + nx
+					if strong[nj] && !visited[nj] {
+						visited[nj] = true
+						stack = append(stack, nj)
+					}
+				}
+			}
+		}
+		if spot.Size < p.MinSpotSize || (p.MaxSpotSize > 0 && spot.Size > p.MaxSpotSize) {
+			continue
+		}
+		if sw > 0 {
+			spot.X = sx / sw
+			spot.Y = sy / sw
+		}
+		spots = append(spots, spot)
+	}
+	return spots
+}
@@ -0,0 +1,112 @@
+package cbf
+
+import (
+	"math"
+	"slices"
+)
+
+// Stats represents basic per-frame statistics
+type Stats struct {
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Valid      int       `json:"valid"`
+	Min        int32     `json:"min"`
+	Max        int32     `json:"max"`
+	Mean       float64   `json:"mean"`
+	Median     float64   `json:"median"`
+	StdDev     float64   `json:"stddev"`
+	Masked     int       `json:"masked"`
+	Zero       int       `json:"zero"`
+	Overloaded int       `json:"overloaded"`
+	Total      int64     `json:"total"`
+	Histogram  Histogram `json:"histogram"`
+}
+
+// Histogram represents intensity histogram, bin i covers [Edges[i], Edges[i+1])
+// counts and the last bin includes its upper edge
+type Histogram struct {
+	Edges  []float64 `json:"edges"`
+	Counts []int     `json:"counts"`
+}
+
+// default number of histogram bins
+var DefaultHistogramBins = 32
+
+// ComputeStats computes statistics of frame pixels which are not masked.
+// If mask is nil the frame default mask is used. Histogram bins are equally
+// spaced in log10(1+counts) since diffraction intensities span many decades.
+func ComputeStats(f *Frame, mask Mask, nbins int) Stats {
+	mask = maskOrDefault(f, mask)
+	if nbins <= 0 {
+		nbins = DefaultHistogramBins
+	}
+
+	st := Stats{Width: f.Width, Height: f.Height}
+	vals := make([]int32, 0, len(f.Pixels))
+	var sum, sum2 float64
+	for i, v := range f.Pixels {
+		if mask[i] {
+			st.Masked++
+			continue
+		}
+		if v == 0 {
+			st.Zero++
+		}
+		if f.Overloaded(v) {
+			st.Overloaded++
+		}
+		st.Total += int64(v)
+		sum += float64(v)
+		sum2 += float64(v) * float64(v)
+		vals = append(vals, v)
+	}
+	st.Valid = len(vals)
+	if st.Valid == 0 {
+		return st
+	}
+
+	slices.Sort(vals)
+	st.Min = vals[0]
+	st.Max = vals[len(vals)-1]
+	n := float64(st.Valid)
+	st.Mean = sum / n
+	st.StdDev = math.Sqrt(math.Max(sum2/n-st.Mean*st.Mean, 0))
+	if len(vals)%2 == 1 {
+		st.Median = float64(vals[len(vals)/2])
+	} else {
+		st.Median = (float64(vals[len(vals)/2-1]) + float64(vals[len(vals)/2])) / 2
+	}
+	st.Histogram = logHistogram(vals, nbins)
+	return st
+}
+
+// logHistogram builds histogram of sorted non-negative values with bins
+// equally spaced in log10(1+v)
+func logHistogram(sorted []int32, nbins int) Histogram {
+	lo := math.Log10(1 + math.Max(float64(sorted[0]), 0))
+	hi := math.Log10(1 + math.Max(float64(sorted[len(sorted)-1]), 0))
+	if hi <= lo {
+		hi = lo + 1
+	}
+	hist := Histogram{
+		Edges:  make([]float64, nbins+1),
+		Counts: make([]int, nbins),
+	}
+	step := (hi - lo) / float64(nbins)
+	for i := range hist.Edges {
+		hist.Edges[i] = math.Pow(10, lo+float64(i)*step) - 1
+	}
+	hist.Edges[0] = float64(sorted[0])
+	hist.Edges[nbins] = float64(sorted[len(sorted)-1])
+	for _, v := range sorted {
+		idx := int((math.Log10(1+math.Max(float64(v), 0)) - lo) / step)
+		if idx >= nbins {
+			idx = nbins - 1
+		}
+		if idx < 0 {
+			idx = 0
+		}
+		hist.Counts[idx]++
+	}
+	return hist
+}
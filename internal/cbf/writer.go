@@ -0,0 +1,153 @@
+package cbf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// size of zero padding after binary section used by PILATUS detectors
+var binaryPadding = 4095
+
+// WriteCBF writes frame to a CBF file with x-CBF_BYTE_OFFSET compression
+func WriteCBF(path string, f *Frame) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if err := EncodeCBF(w, f, name); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// EncodeCBF writes frame in CBF format to given writer, name is used as
+// CIF data block name
+func EncodeCBF(w io.Writer, f *Frame, name string) error {
+	if len(f.Pixels) != f.Width*f.Height {
+		return fmt.Errorf("pixel count mismatch: %d vs %d", len(f.Pixels), f.Width*f.Height)
+	}
+	data := encByteOffset(f.Pixels)
+	sum := md5.Sum(data)
+
+	var hdr bytes.Buffer
+	fmt.Fprintf(&hdr, "###CBF: VERSION 1.5, cbf2go\n\ndata_%s\n\n", name)
+	fmt.Fprintf(&hdr, "_array_data.header_convention \"PILATUS_1.2\"\n")
+	fmt.Fprintf(&hdr, "_array_data.header_contents\n;\n")
+	for _, l := range pilatusHeaderLines(f) {
+		fmt.Fprintf(&hdr, "# %s\n", l)
+	}
+	fmt.Fprintf(&hdr, ";\n\n_array_data.data\n;\n")
+	fmt.Fprintf(&hdr, "--CIF-BINARY-FORMAT-SECTION--\n")
+	fmt.Fprintf(&hdr, "Content-Type: application/octet-stream;\n")
+	fmt.Fprintf(&hdr, "     conversions=\"x-CBF_BYTE_OFFSET\"\n")
+	fmt.Fprintf(&hdr, "Content-Transfer-Encoding: BINARY\n")
+	fmt.Fprintf(&hdr, "X-Binary-Size: %d\n", len(data))
+	fmt.Fprintf(&hdr, "X-Binary-ID: 1\n")
+	fmt.Fprintf(&hdr, "X-Binary-Element-Type: \"signed 32-bit integer\"\n")
+	fmt.Fprintf(&hdr, "X-Binary-Element-Byte-Order: LITTLE_ENDIAN\n")
+	fmt.Fprintf(&hdr, "Content-MD5: %s\n", base64.StdEncoding.EncodeToString(sum[:]))
+	fmt.Fprintf(&hdr, "X-Binary-Number-of-Elements: %d\n", len(f.Pixels))
+	fmt.Fprintf(&hdr, "X-Binary-Size-Fastest-Dimension: %d\n", f.Width)
+	fmt.Fprintf(&hdr, "X-Binary-Size-Second-Dimension: %d\n", f.Height)
+	fmt.Fprintf(&hdr, "X-Binary-Size-Padding: %d\n\n", binaryPadding)
+
+	for _, chunk := range [][]byte{hdr.Bytes(), starter, data, make([]byte, binaryPadding)} {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n--CIF-BINARY-FORMAT-SECTION----\n;\n\n")
+	return err
+}
+
+// ------------------------------------------------------------
+// BYTE_OFFSET encoder (inverse of decByteOffsetFabio)
+// ------------------------------------------------------------
+func encByteOffset(pixels []int32) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(pixels)))
+	var prev int64
+	var b [4]byte
+	for _, v := range pixels {
+		delta := int64(v) - prev
+		prev = int64(v)
+		switch {
+		case delta > math.MinInt8 && delta <= math.MaxInt8:
+			buf.WriteByte(byte(int8(delta)))
+		case delta > math.MinInt16 && delta <= math.MaxInt16:
+			buf.WriteByte(0x80)
+			binary.LittleEndian.PutUint16(b[:2], uint16(int16(delta)))
+			buf.Write(b[:2])
+		default:
+			buf.Write([]byte{0x80, 0x00, 0x80})
+			binary.LittleEndian.PutUint32(b[:], uint32(int32(delta)))
+			buf.Write(b[:])
+		}
+	}
+	return buf.Bytes()
+}
+
+// pilatusHeaderLines returns PILATUS header lines of the frame, lines of
+// original header are kept and values known to Metadata are updated
+func pilatusHeaderLines(f *Frame) []string {
+	m := f.Meta
+	type entry struct {
+		line string
+		set  bool // value is known and should be written
+	}
+	keys := []string{
+		"Detector:", "Pixel_size", "Exposure_time", "Count_cutoff", "Wavelength",
+		"Detector_distance", "Beam_xy", "Start_angle", "Angle_increment",
+	}
+	entries := map[string]entry{
+		"Detector:":         {"Detector: " + m.Detector, m.Detector != ""},
+		"Pixel_size":        {fmt.Sprintf("Pixel_size %ge-6 m x %ge-6 m", microns(m.PixelSizeX), microns(m.PixelSizeY)), m.PixelSizeX > 0},
+		"Exposure_time":     {fmt.Sprintf("Exposure_time %.7f s", m.ExposureTime), m.ExposureTime > 0},
+		"Count_cutoff":      {fmt.Sprintf("Count_cutoff %d counts", m.CountCutoff), m.CountCutoff > 0},
+		"Wavelength":        {fmt.Sprintf("Wavelength %.5f A", m.Wavelength), m.Wavelength > 0},
+		"Detector_distance": {fmt.Sprintf("Detector_distance %.5f m", m.DetectorDistance), m.DetectorDistance > 0},
+		"Beam_xy":           {fmt.Sprintf("Beam_xy (%.2f, %.2f) pixels", m.BeamX, m.BeamY), m.BeamX != 0 || m.BeamY != 0},
+		"Start_angle":       {fmt.Sprintf("Start_angle %.4f deg.", m.StartAngle), true},
+		"Angle_increment":   {fmt.Sprintf("Angle_increment %.4f deg.", m.AngleIncrement), m.AngleIncrement != 0},
+	}
+
+	var lines []string
+	written := make(map[string]bool)
+	for _, l := range f.Contents {
+		fields := strings.Fields(l)
+		if len(fields) > 0 {
+			if e, ok := entries[fields[0]]; ok && e.set {
+				lines = append(lines, e.line)
+				written[fields[0]] = true
+				continue
+			}
+		}
+		lines = append(lines, l)
+	}
+	for _, k := range keys {
+		if e := entries[k]; e.set && !written[k] {
+			lines = append(lines, e.line)
+		}
+	}
+	return lines
+}
+
+// microns converts meters to microns rounded to nanometers
+func microns(v float64) float64 {
+	return math.Round(v*1e9) / 1e3
+}
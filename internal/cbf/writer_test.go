@@ -0,0 +1,58 @@
+package cbf
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWriteCBFRoundTrip(t *testing.T) {
+	f := &Frame{
+		Pixels: []int32{0, 1, -1, 127, 128, -2, 40000, 1 << 30, 3, 2, 1, 0},
+		Width:  4,
+		Height: 3,
+		Meta: Metadata{
+			Detector:         "PILATUS 6M, S/N 60-0100",
+			PixelSizeX:       172e-6,
+			PixelSizeY:       172e-6,
+			Wavelength:       0.97949,
+			DetectorDistance: 0.25,
+			BeamX:            1231.5,
+			BeamY:            1263.25,
+			StartAngle:       12.5,
+			AngleIncrement:   0.1,
+			ExposureTime:     0.2,
+			CountCutoff:      1048500,
+		},
+		Contents: []string{"Silicon sensor, thickness 0.000320 m", "Count_cutoff 100 counts"},
+	}
+	path := filepath.Join(t.TempDir(), "test_00001.cbf")
+	if err := WriteCBF(path, f); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ReadFrame(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Width != f.Width || out.Height != f.Height || !slices.Equal(out.Pixels, f.Pixels) {
+		t.Errorf("got %dx%d %v, expected %dx%d %v", out.Width, out.Height, out.Pixels, f.Width, f.Height, f.Pixels)
+	}
+	if out.Meta != f.Meta {
+		t.Errorf("got header %+v, expected %+v", out.Meta, f.Meta)
+	}
+	// unknown lines are kept and known ones are updated in place
+	if len(out.Contents) == 0 || out.Contents[0] != f.Contents[0] {
+		t.Errorf("original header line was not kept: %q", out.Contents)
+	}
+	if !slices.Contains(out.Contents, "Count_cutoff 1048500 counts") || slices.Contains(out.Contents, f.Contents[1]) {
+		t.Errorf("count cutoff line was not updated: %q", out.Contents)
+	}
+}
+
+func TestEncodeCBFMismatch(t *testing.T) {
+	f := &Frame{Pixels: make([]int32, 5), Width: 2, Height: 2}
+	if err := EncodeCBF(&bytes.Buffer{}, f, "test"); err == nil {
+		t.Error("expected error of pixel count mismatch")
+	}
+}
@@ -0,0 +1,288 @@
+package embed
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+)
+
+// Binary batch protocol of embedding service. Request body of
+// POST /embed/batch has content type BatchContentType (optionally with
+// Content-Encoding: gzip) and consists of little-endian header
+//
+//	magic   [4]byte "CBFB"
+//	version uint16
+//	dtype   uint8   (1 int32, 2 float32)
+//	flags   uint8   (reserved, zero)
+//	count   uint32  number of frames
+//
+// followed by count frames, every frame is height and width as uint32 and
+// height*width pixel values of dtype in row-major order. Response is JSON
+// BatchResponse. Service announces protocol support via GET /capabilities.
+const (
+	BatchContentType = "application/x-cbf2go-batch"
+	BatchVersion     = 1
+	DTypeInt32       = 1
+	DTypeFloat32     = 2
+)
+
+var batchMagic = [4]byte{'C', 'B', 'F', 'B'}
+
+// PixelFrame represents frame pixels sent to embedding service
+type PixelFrame struct {
+	Pixels []int32
+	Width  int
+	Height int
+}
+
+// BatchResponse represents response of batch embedding request
+type BatchResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Dim        int         `json:"dim"`
+}
+
+// Capabilities represents protocols supported by embedding service
+type Capabilities struct {
+	Batch     bool     `json:"batch"`     // service supports binary batch protocol
+	DTypes    []string `json:"dtypes"`    // supported pixel types: int32, float32
+	Encodings []string `json:"encodings"` // supported content encodings: gzip
+	MaxBatch  int      `json:"max_batch"` // maximum number of frames per request, zero means no limit
+}
+
+// EncodeBatch writes frames to w in binary batch format with given dtype
+func EncodeBatch(w io.Writer, frames []PixelFrame, dtype uint8) error {
+	if dtype != DTypeInt32 && dtype != DTypeFloat32 {
+		return fmt.Errorf("unsupported batch dtype %d", dtype)
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(batchMagic[:])
+	binary.Write(bw, binary.LittleEndian, uint16(BatchVersion))
+	bw.WriteByte(dtype)
+	bw.WriteByte(0)
+	binary.Write(bw, binary.LittleEndian, uint32(len(frames)))
+	buf := make([]byte, 4)
+	for _, f := range frames {
+		if len(f.Pixels) != f.Width*f.Height {
+			return fmt.Errorf("pixel count mismatch: %d vs %d", len(f.Pixels), f.Width*f.Height)
+		}
+		binary.Write(bw, binary.LittleEndian, uint32(f.Height))
+		binary.Write(bw, binary.LittleEndian, uint32(f.Width))
+		for _, v := range f.Pixels {
+			if dtype == DTypeInt32 {
+				binary.LittleEndian.PutUint32(buf, uint32(v))
+			} else {
+				binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v)))
+			}
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// limits of decoded batches, frame sizes are validated before their pixels
+// are allocated
+var (
+	MaxBatchBytes int64 = 1 << 30 // maximum size of batch body
+	MaxFrameSide        = 1 << 15 // maximum width and height of a frame
+)
+
+// DecodeBatch reads frames in binary batch format, float32 values are
+// rounded to int32 counts. Body is read up to MaxBatchBytes, so pixels of
+// every frame are checked against the bytes left before allocation.
+func DecodeBatch(r io.Reader) ([]PixelFrame, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBatchBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch: %w", err)
+	}
+	if int64(len(data)) > MaxBatchBytes {
+		return nil, fmt.Errorf("batch exceeds %d bytes", MaxBatchBytes)
+	}
+	br := bytes.NewReader(data)
+	var hdr struct {
+		Magic   [4]byte
+		Version uint16
+		DType   uint8
+		Flags   uint8
+		Count   uint32
+	}
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("failed to read batch header: %w", err)
+	}
+	if hdr.Magic != batchMagic {
+		return nil, errors.New("invalid batch magic")
+	}
+	if hdr.Version != BatchVersion {
+		return nil, fmt.Errorf("unsupported batch version %d", hdr.Version)
+	}
+	if hdr.DType != DTypeInt32 && hdr.DType != DTypeFloat32 {
+		return nil, fmt.Errorf("unsupported batch dtype %d", hdr.DType)
+	}
+	// every frame takes at least 8 bytes of its size
+	if int64(hdr.Count) > int64(br.Len()/8) {
+		return nil, fmt.Errorf("batch of %d frames exceeds %d bytes", hdr.Count, len(data))
+	}
+	frames := make([]PixelFrame, 0, hdr.Count)
+	for i := uint32(0); i < hdr.Count; i++ {
+		var dims [2]uint32
+		if err := binary.Read(br, binary.LittleEndian, &dims); err != nil {
+			return nil, fmt.Errorf("failed to read frame %d size: %w", i, err)
+		}
+		if dims[0] == 0 || dims[1] == 0 || dims[0] > uint32(MaxFrameSide) || dims[1] > uint32(MaxFrameSide) {
+			return nil, fmt.Errorf("invalid size %dx%d of frame %d", dims[1], dims[0], i)
+		}
+		h, w := int(dims[0]), int(dims[1])
+		size := 4 * int64(w) * int64(h)
+		if size > int64(br.Len()) {
+			return nil, fmt.Errorf("frame %d of %dx%d pixels exceeds %d bytes left", i, w, h, br.Len())
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("failed to read frame %d pixels: %w", i, err)
+		}
+		f := PixelFrame{Width: w, Height: h, Pixels: make([]int32, w*h)}
+		for j := range f.Pixels {
+			u := binary.LittleEndian.Uint32(buf[4*j:])
+			if hdr.DType == DTypeInt32 {
+				f.Pixels[j] = int32(u)
+			} else {
+				f.Pixels[j] = int32(math.Round(float64(math.Float32frombits(u))))
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
+
+// errBatchUnsupported is returned when service does not support batch protocol
+var errBatchUnsupported = errors.New("batch protocol is not supported by embedding service")
+
+// Capabilities returns protocols supported by embedding service, result of
+// the first successful call is cached. Services without /capabilities
+// endpoint are assumed to support JSON protocol only.
+func (c *EmbedClient) Capabilities(ctx context.Context) (Capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil {
+		return *c.caps, nil
+	}
+	var caps Capabilities
+	data, err := c.requester().do(ctx, "GET", c.BaseURL+"/capabilities", nil, nil)
+	var herr *HTTPError
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &caps); err != nil {
+			return Capabilities{}, err
+		}
+	case errors.As(err, &herr) && (herr.StatusCode == http.StatusNotFound || herr.StatusCode == http.StatusMethodNotAllowed):
+		// old service, JSON protocol only
+	default:
+		return Capabilities{}, err
+	}
+	c.caps = &caps
+	return caps, nil
+}
+
+// EmbedBatch returns embeddings of several frames. It uses binary batch
+// protocol if service supports it and falls back to one JSON request per
+// frame otherwise.
+func (c *EmbedClient) EmbedBatch(ctx context.Context, frames []PixelFrame) ([][]float32, error) {
+	if !c.DisableBatch {
+		caps, err := c.Capabilities(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if caps.Batch {
+			out := make([][]float32, 0, len(frames))
+			step := len(frames)
+			if caps.MaxBatch > 0 {
+				step = caps.MaxBatch
+			}
+			for i := 0; i < len(frames); i += step {
+				vecs, err := c.embedBatch(ctx, frames[i:min(i+step, len(frames))], caps)
+				if errors.Is(err, errBatchUnsupported) {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, vecs...)
+			}
+			if len(out) == len(frames) {
+				return out, nil
+			}
+			// service rejected batch protocol, do not try it again
+			c.capsMu.Lock()
+			c.caps = &Capabilities{}
+			c.capsMu.Unlock()
+		}
+	}
+
+	// JSON fallback
+	out := make([][]float32, 0, len(frames))
+	for _, f := range frames {
+		pixels := make([]float32, len(f.Pixels))
+		for i, p := range f.Pixels {
+			pixels[i] = float32(p)
+		}
+		vec, err := c.EmbedPixels(ctx, pixels, f.Height, f.Width)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vec)
+	}
+	return out, nil
+}
+
+// embedBatch sends single batch request
+func (c *EmbedClient) embedBatch(ctx context.Context, frames []PixelFrame, caps Capabilities) ([][]float32, error) {
+	dtype := uint8(DTypeInt32)
+	if len(caps.DTypes) > 0 && !slices.Contains(caps.DTypes, "int32") {
+		dtype = DTypeFloat32
+	}
+	useGzip := c.Gzip && slices.Contains(caps.Encodings, "gzip")
+
+	var body bytes.Buffer
+	if useGzip {
+		zw := gzip.NewWriter(&body)
+		if err := EncodeBatch(zw, frames, dtype); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	} else if err := EncodeBatch(&body, frames, dtype); err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{"Content-Type": BatchContentType}
+	if useGzip {
+		header["Content-Encoding"] = "gzip"
+	}
+	data, err := c.requester().do(ctx, "POST", c.BaseURL+"/embed/batch", body.Bytes(), header)
+	var herr *HTTPError
+	if errors.As(err, &herr) && (herr.StatusCode == http.StatusNotFound || herr.StatusCode == http.StatusUnsupportedMediaType) {
+		return nil, errBatchUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out BatchResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Embeddings) != len(frames) {
+		return nil, fmt.Errorf("batch response has %d embeddings for %d frames", len(out.Embeddings), len(frames))
+	}
+	return out.Embeddings, nil
+}
@@ -0,0 +1,200 @@
+package embed_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cbf2go/internal/embed"
+	"cbf2go/internal/embed/mock"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	frames := testFrames(3)
+	frames[1].Pixels[0] = -1 // masked pixel
+	for _, dtype := range []uint8{embed.DTypeInt32, embed.DTypeFloat32} {
+		var buf bytes.Buffer
+		if err := embed.EncodeBatch(&buf, frames, dtype); err != nil {
+			t.Fatal(err)
+		}
+		out, err := embed.DecodeBatch(&buf)
+		if err != nil {
+			t.Fatalf("dtype %d: %v", dtype, err)
+		}
+		if !reflect.DeepEqual(out, frames) {
+			t.Errorf("dtype %d: decoded frames differ", dtype)
+		}
+	}
+}
+
+func TestEncodeBatchErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := embed.EncodeBatch(&buf, testFrames(1), 7); err == nil {
+		t.Error("expected error of unsupported dtype")
+	}
+	bad := []embed.PixelFrame{{Pixels: make([]int32, 5), Width: 2, Height: 2}}
+	if err := embed.EncodeBatch(&buf, bad, embed.DTypeInt32); err == nil {
+		t.Error("expected error of pixel count mismatch")
+	}
+}
+
+// batchHeader returns batch header with given frame count followed by
+// frame sizes
+func batchHeader(count uint32, sizes ...uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("CBFB")
+	binary.Write(&buf, binary.LittleEndian, uint16(embed.BatchVersion))
+	buf.WriteByte(embed.DTypeInt32)
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, count)
+	for _, s := range sizes {
+		binary.Write(&buf, binary.LittleEndian, s)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBatchErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := embed.EncodeBatch(&valid, testFrames(2), embed.DTypeInt32); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "header"},
+		{"magic", append([]byte("XXXX"), batchHeader(0)[4:]...), "magic"},
+		{"count", batchHeader(1 << 30), "frames exceeds"},
+		{"zero side", batchHeader(1, 0, 10), "invalid size"},
+		{"large side", batchHeader(1, 1<<20, 1), "invalid size"},
+		{"large frame", batchHeader(1, 1<<15, 1<<15), "bytes left"},
+		{"truncated", valid.Bytes()[:valid.Len()-3], "bytes left"},
+	}
+	for _, c := range cases {
+		_, err := embed.DecodeBatch(bytes.NewReader(c.data))
+		if err == nil {
+			t.Errorf("%s: expected error", c.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestDecodeBatchLimit(t *testing.T) {
+	limit := embed.MaxBatchBytes
+	defer func() { embed.MaxBatchBytes = limit }()
+	var buf bytes.Buffer
+	if err := embed.EncodeBatch(&buf, testFrames(2), embed.DTypeInt32); err != nil {
+		t.Fatal(err)
+	}
+	embed.MaxBatchBytes = int64(buf.Len() - 1)
+	if _, err := embed.DecodeBatch(&buf); err == nil {
+		t.Error("expected error of batch exceeding MaxBatchBytes")
+	}
+}
+
+// testFrames returns n small frames with different content
+func testFrames(n int) []embed.PixelFrame {
+	frames := make([]embed.PixelFrame, n)
+	for i := range frames {
+		w, h := 8+i, 6
+		pixels := make([]int32, w*h)
+		for j := range pixels {
+			pixels[j] = int32((j*(i+3))%97 + i)
+		}
+		frames[i] = embed.PixelFrame{Pixels: pixels, Width: w, Height: h}
+	}
+	return frames
+}
+
+func TestEmbedBatch(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.MaxBatch = 2
+	h, url := newMock(t, cfg)
+	c := newClient(url)
+	frames := testFrames(5)
+
+	vecs, err := c.EmbedBatch(context.Background(), frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != len(frames) {
+		t.Fatalf("got %d embeddings of %d frames", len(vecs), len(frames))
+	}
+	stats := h.Stats()
+	if stats.Requests["/embed/batch"] != 3 || stats.Requests["/embed/pixels"] != 0 {
+		t.Errorf("expected 3 batch requests of at most 2 frames, got %v", stats.Requests)
+	}
+
+	// batch and JSON protocols return the same embeddings
+	for i, f := range frames {
+		pixels := make([]float32, len(f.Pixels))
+		for j, p := range f.Pixels {
+			pixels[j] = float32(p)
+		}
+		vec, err := c.EmbedPixels(context.Background(), pixels, f.Height, f.Width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vec, vecs[i]) {
+			t.Errorf("frame %d: batch and JSON embeddings differ", i)
+		}
+	}
+}
+
+func TestEmbedBatchGzip(t *testing.T) {
+	h, url := newMock(t, mock.DefaultConfig())
+	c := newClient(url)
+	c.Gzip = true
+
+	vecs, err := c.EmbedBatch(context.Background(), testFrames(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != 3 || h.Stats().Requests["/embed/batch"] != 1 {
+		t.Errorf("expected 3 embeddings in 1 request, got %d in %v", len(vecs), h.Stats().Requests)
+	}
+}
+
+func TestEmbedBatchFallback(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.Batch = false
+	h, url := newMock(t, cfg)
+	c := newClient(url)
+
+	vecs, err := c.EmbedBatch(context.Background(), testFrames(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != 3 {
+		t.Fatalf("got %d embeddings of 3 frames", len(vecs))
+	}
+	stats := h.Stats()
+	if stats.Requests["/embed/batch"] != 0 || stats.Requests["/embed/pixels"] != 3 {
+		t.Errorf("expected 3 JSON requests, got %v", stats.Requests)
+	}
+	caps, err := c.Capabilities(context.Background())
+	if err != nil || caps.Batch {
+		t.Errorf("expected JSON only capabilities, got %+v, %v", caps, err)
+	}
+}
+
+func TestEmbedBatchDisabled(t *testing.T) {
+	h, url := newMock(t, mock.DefaultConfig())
+	c := newClient(url)
+	c.DisableBatch = true
+
+	if _, err := c.EmbedBatch(context.Background(), testFrames(2)); err != nil {
+		t.Fatal(err)
+	}
+	stats := h.Stats()
+	if stats.Requests["/capabilities"] != 0 || stats.Requests["/embed/pixels"] != 2 {
+		t.Errorf("expected 2 JSON requests without negotiation, got %v", stats.Requests)
+	}
+}
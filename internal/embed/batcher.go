@@ -0,0 +1,153 @@
+package embed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cbf2go/internal/cbf"
+)
+
+// DefaultBatchLinger is maximum time a frame waits for other frames of its batch
+var DefaultBatchLinger = 50 * time.Millisecond
+
+// BatchLimiter represents embedder which reports how many frames it embeds
+// in one request
+type BatchLimiter interface {
+	// BatchLimit returns maximum number of frames per request, zero means
+	// no limit and 1 means that frames are embedded one by one
+	BatchLimit(ctx context.Context) (int, error)
+}
+
+// BatchLimit returns batch limit of embedder, embedders which do not
+// implement BatchLimiter embed frames one by one
+func BatchLimit(ctx context.Context, e Embedder) (int, error) {
+	if bl, ok := e.(BatchLimiter); ok {
+		return bl.BatchLimit(ctx)
+	}
+	return 1, nil
+}
+
+// batchRequest represents frame waiting for its embedding
+type batchRequest struct {
+	frame  *cbf.Frame
+	result chan batchResult
+}
+
+// batchResult represents embedding of a frame or error of its batch
+type batchResult struct {
+	vec []float32
+	err error
+}
+
+// Batcher collects frames embedded concurrently by several goroutines and
+// embeds up to Size of them with single EmbedFrames call. Batch is sent
+// when it is full or when its first frame waited for Linger. Error of a
+// batch call is reported to all its frames.
+type Batcher struct {
+	embedder Embedder
+	size     int
+	linger   time.Duration
+	ctx      context.Context
+	reqs     chan batchRequest
+	finished chan struct{}
+	inflight sync.WaitGroup
+}
+
+// NewBatcher starts batching of frames of given embedder, batch calls are
+// canceled with ctx. Batcher must be stopped by Close.
+func NewBatcher(ctx context.Context, e Embedder, size int, linger time.Duration) *Batcher {
+	if linger <= 0 {
+		linger = DefaultBatchLinger
+	}
+	b := &Batcher{
+		embedder: e,
+		size:     max(size, 1),
+		linger:   linger,
+		ctx:      ctx,
+		reqs:     make(chan batchRequest),
+		finished: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Embed returns embedding of the frame computed in batch with frames of
+// other callers
+func (b *Batcher) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	req := batchRequest{frame: f, result: make(chan batchResult, 1)}
+	select {
+	case b.reqs <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case r := <-req.result:
+		return r.vec, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close embeds pending frames and stops the batcher, no frames may be
+// embedded afterwards
+func (b *Batcher) Close() {
+	close(b.reqs)
+	<-b.finished
+}
+
+// run collects frames into batches until batcher is closed
+func (b *Batcher) run() {
+	var batch []batchRequest
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) > 0 {
+			b.inflight.Add(1)
+			go b.embed(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case req, ok := <-b.reqs:
+			if !ok {
+				flush()
+				b.inflight.Wait()
+				close(b.finished)
+				return
+			}
+			batch = append(batch, req)
+			if len(batch) == 1 {
+				timer = time.NewTimer(b.linger)
+				timeout = timer.C
+			}
+			if len(batch) >= b.size {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+// embed embeds batch of frames and hands vectors back to their callers
+func (b *Batcher) embed(batch []batchRequest) {
+	defer b.inflight.Done()
+	frames := make([]*cbf.Frame, len(batch))
+	for i, req := range batch {
+		frames[i] = req.frame
+	}
+	vecs, err := EmbedFrames(b.ctx, b.embedder, frames)
+	for i, req := range batch {
+		if err != nil {
+			req.result <- batchResult{err: err}
+			continue
+		}
+		req.result <- batchResult{vec: vecs[i]}
+	}
+}
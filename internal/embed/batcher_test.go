@@ -0,0 +1,56 @@
+package embed_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
+	"cbf2go/internal/embed/mock"
+)
+
+func TestBatcher(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.MaxBatch = 4
+	h, url := newMock(t, cfg)
+	e := &embed.PixelEmbedder{Method: embed.MethodResNet, Client: newClient(url)}
+	ctx := context.Background()
+
+	limit, err := embed.BatchLimit(ctx, e)
+	if err != nil || limit != 4 {
+		t.Fatalf("expected batch limit 4, got %d, %v", limit, err)
+	}
+	b := embed.NewBatcher(ctx, e, limit, time.Second)
+	frames := testFrames(8)
+	vecs := make([][]float32, len(frames))
+	var wg sync.WaitGroup
+	for i, f := range frames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			frame := &cbf.Frame{Pixels: f.Pixels, Width: f.Width, Height: f.Height}
+			vec, err := b.Embed(ctx, frame)
+			if err != nil {
+				t.Error(err)
+			}
+			vecs[i] = vec
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	if n := h.Stats().Requests["/embed/batch"]; n != 2 {
+		t.Errorf("expected 8 frames in 2 batch requests, got %d", n)
+	}
+	// every caller receives embedding of its own frame
+	want, err := e.Client.EmbedBatch(ctx, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vecs, want) {
+		t.Error("batched embeddings do not match their frames")
+	}
+}
@@ -0,0 +1,266 @@
+package embed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cbf2go/internal/cbf"
+)
+
+// version of cache key and file format, changing it invalidates the cache
+const cacheVersion = "v1"
+
+// extension of cached vector files
+const cacheExt = ".vec"
+
+// Parameterized is implemented by embedders which output depends on
+// parameters not included in method name, e.g. image size or service URL
+type Parameterized interface {
+	Params() string
+}
+
+// Cache represents content addressed on-disk cache of embedding vectors.
+// Vectors are stored in Dir/<key[:2]>/<key>.vec files, when total size
+// exceeds MaxBytes least recently used files are evicted.
+type Cache struct {
+	Dir      string
+	MaxBytes int64 // zero means no limit
+
+	mu    sync.Mutex
+	size  int64
+	files map[string]cacheEntry // key -> entry
+}
+
+// cacheEntry represents cached file
+type cacheEntry struct {
+	size  int64
+	atime time.Time
+}
+
+// OpenCache opens or creates cache in given directory
+func OpenCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{Dir: dir, MaxBytes: maxBytes, files: make(map[string]cacheEntry)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, cacheExt) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := strings.TrimSuffix(d.Name(), cacheExt)
+		c.files[key] = cacheEntry{size: info.Size(), atime: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CacheKey returns cache key of frame embedding with given embedder
+func CacheKey(e Embedder, f *cbf.Frame) string {
+	params := ""
+	if p, ok := e.(Parameterized); ok {
+		params = p.Params()
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", cacheVersion, cbf.FrameHash(f), e.Name(), params)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns file path of cached vector
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+cacheExt)
+}
+
+// Get returns cached vector, missing or unreadable entries are reported as
+// cache misses
+func (c *Cache) Get(key string) ([]float32, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < 4 {
+		return nil, false
+	}
+	dim := int(binary.LittleEndian.Uint32(data))
+	if len(data) != 4+4*dim {
+		return nil, false
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4+4*i:]))
+	}
+
+	// file modification time is used as access time of LRU eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	c.mu.Lock()
+	c.files[key] = cacheEntry{size: int64(len(data)), atime: now}
+	c.mu.Unlock()
+	return vec, true
+}
+
+// Put stores vector in the cache and evicts old entries if cache exceeds
+// its size limit
+func (c *Cache) Put(key string, vec []float32) error {
+	data := make([]byte, 4+4*len(vec))
+	binary.LittleEndian.PutUint32(data, uint32(len(vec)))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(data[4+4*i:], math.Float32bits(v))
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to temporary file first, so concurrent readers never see
+	// partial vectors
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.files[key]; ok {
+		c.size -= old.size
+	}
+	c.files[key] = cacheEntry{size: int64(len(data)), atime: time.Now()}
+	c.size += int64(len(data))
+	if c.MaxBytes > 0 && c.size > c.MaxBytes {
+		c.evict()
+	}
+	return nil
+}
+
+// evict removes least recently used entries until cache size drops below
+// 90% of its limit, caller must hold the lock
+func (c *Cache) evict() {
+	keys := make([]string, 0, len(c.files))
+	for key := range c.files {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return c.files[keys[i]].atime.Before(c.files[keys[j]].atime) })
+	target := c.MaxBytes * 9 / 10
+	for _, key := range keys {
+		if c.size <= target {
+			break
+		}
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		c.size -= c.files[key].size
+		delete(c.files, key)
+	}
+}
+
+// Size returns number of cached vectors and their total size in bytes
+func (c *Cache) Size() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.files), c.size
+}
+
+// WithCache wraps embedder with cache, nil cache returns embedder as is
+func WithCache(e Embedder, c *Cache) Embedder {
+	if c == nil {
+		return e
+	}
+	return &CachedEmbedder{Base: e, Cache: c}
+}
+
+// CachedEmbedder represents embedder which looks up vectors in cache before
+// computing them
+type CachedEmbedder struct {
+	Base  Embedder
+	Cache *Cache
+}
+
+// Name implements Embedder interface
+func (e *CachedEmbedder) Name() string { return e.Base.Name() }
+
+// Dimension implements Embedder interface
+func (e *CachedEmbedder) Dimension() int { return e.Base.Dimension() }
+
+// Params implements Parameterized interface
+func (e *CachedEmbedder) Params() string {
+	if p, ok := e.Base.(Parameterized); ok {
+		return p.Params()
+	}
+	return ""
+}
+
+// BatchLimit implements BatchLimiter interface
+func (e *CachedEmbedder) BatchLimit(ctx context.Context) (int, error) {
+	return BatchLimit(ctx, e.Base)
+}
+
+// Embed implements Embedder interface
+func (e *CachedEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	vecs, err := e.EmbedBatch(ctx, []*cbf.Frame{f})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch implements BatchEmbedder interface, only frames missing in the
+// cache are passed to base embedder
+func (e *CachedEmbedder) EmbedBatch(ctx context.Context, frames []*cbf.Frame) ([][]float32, error) {
+	vecs := make([][]float32, len(frames))
+	keys := make([]string, len(frames))
+	var missing []*cbf.Frame
+	var idx []int
+	for i, f := range frames {
+		keys[i] = CacheKey(e.Base, f)
+		if vec, ok := e.Cache.Get(keys[i]); ok {
+			vecs[i] = vec
+			continue
+		}
+		missing = append(missing, f)
+		idx = append(idx, i)
+	}
+	if len(missing) == 0 {
+		return vecs, nil
+	}
+	out, err := EmbedFrames(ctx, e.Base, missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, vec := range out {
+		i := idx[j]
+		vecs[i] = vec
+		if err := e.Cache.Put(keys[i], vec); err != nil {
+			fmt.Printf("unable to cache embedding: %v\n", err)
+		}
+	}
+	return vecs, nil
+}
@@ -1,16 +1,27 @@
 package embed
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type EmbedClient struct {
 	BaseURL    string
 	HttpClient *http.Client
+	// compress batch requests with gzip if service supports it
+	Gzip bool
+	// always use JSON protocol
+	DisableBatch bool
+	// retry policy of transient errors
+	Retry RetryPolicy
+	// circuit breaker which pauses requests when service is down
+	Breaker *CircuitBreaker
+
+	capsMu sync.Mutex
+	caps   *Capabilities // capabilities of embedding service, nil until negotiated
 }
 
 func NewEmbedClient(baseURL string) *EmbedClient {
@@ -19,6 +30,8 @@ func NewEmbedClient(baseURL string) *EmbedClient {
 		HttpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Retry:   DefaultRetryPolicy(),
+		Breaker: NewCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
 	}
 }
 
@@ -34,7 +47,12 @@ type EmbedResponse struct {
 	Dim       int       `json:"dim"`
 }
 
-func (c *EmbedClient) EmbedPixels(pixels []float32, h, w int) ([]float32, error) {
+// requester returns requester with client settings
+func (c *EmbedClient) requester() requester {
+	return requester{client: c.HttpClient, retry: c.Retry, breaker: c.Breaker}
+}
+
+func (c *EmbedClient) EmbedPixels(ctx context.Context, pixels []float32, h, w int) ([]float32, error) {
 	reqBody := PixelRequest{
 		Pixels: pixels,
 		Height: h,
@@ -47,29 +65,14 @@ func (c *EmbedClient) EmbedPixels(pixels []float32, h, w int) ([]float32, error)
 		return nil, err
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		c.BaseURL+"/embed/pixels",
-		bytes.NewReader(data),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.HttpClient.Do(req)
+	body, err := c.requester().do(ctx, "POST", c.BaseURL+"/embed/pixels", data,
+		map[string]string{"Content-Type": "application/json"})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server error: %s", resp.Status)
-	}
 
 	var out EmbedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	if err := json.Unmarshal(body, &out); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,113 @@
+package embed_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"cbf2go/internal/embed"
+	"cbf2go/internal/embed/mock"
+)
+
+// testRetry is retry policy with short backoff
+var testRetry = embed.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+
+// newMock starts mock embedding service with given configuration
+func newMock(t *testing.T, cfg mock.Config) (*mock.Handler, string) {
+	t.Helper()
+	h := mock.NewHandler(cfg)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, srv.URL
+}
+
+// newClient returns embedding client of the service with test retry policy
+func newClient(url string) *embed.EmbedClient {
+	c := embed.NewEmbedClient(url)
+	c.Retry = testRetry
+	return c
+}
+
+func TestEmbedPixelsRetry(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.FailFirst = 2
+	h, url := newMock(t, cfg)
+	c := newClient(url)
+
+	vec, err := c.EmbedPixels(context.Background(), make([]float32, 12), 3, 4)
+	if err != nil {
+		t.Fatalf("embedding failed after retries: %v", err)
+	}
+	if len(vec) != cfg.Dim {
+		t.Errorf("embedding size %d, expected %d", len(vec), cfg.Dim)
+	}
+	if stats := h.Stats(); stats.Failures != 2 || stats.Requests["/embed/pixels"] != 3 {
+		t.Errorf("expected 2 failures in 3 requests, got %+v", stats)
+	}
+}
+
+func TestEmbedPixelsRetriesExhausted(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.FailFirst = 10
+	h, url := newMock(t, cfg)
+	c := newClient(url)
+	c.Retry.MaxRetries = 1
+
+	_, err := c.EmbedPixels(context.Background(), make([]float32, 12), 3, 4)
+	var herr *embed.HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != cfg.ErrorStatus {
+		t.Fatalf("expected HTTP error %d, got %v", cfg.ErrorStatus, err)
+	}
+	if n := h.Stats().Requests["/embed/pixels"]; n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestCLIPClient(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.FailFirst = 1
+	h, url := newMock(t, cfg)
+	c := embed.NewCLIPClient(url)
+	c.Retry = testRetry
+	ctx := context.Background()
+
+	text, err := c.EmbedText(ctx, "diffraction with ice rings")
+	if err != nil {
+		t.Fatalf("text embedding failed after retry: %v", err)
+	}
+	again, err := c.EmbedText(ctx, "diffraction with ice rings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(text) != cfg.Dim || !reflect.DeepEqual(text, again) {
+		t.Errorf("expected deterministic text embedding of size %d", cfg.Dim)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 4)
+	}
+	img.Set(0, 0, color.Gray{Y: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	vec, err := c.EmbedImage(ctx, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vec) != cfg.Dim {
+		t.Errorf("image embedding size %d, expected %d", len(vec), cfg.Dim)
+	}
+	stats := h.Stats()
+	if stats.Failures != 1 || stats.Requests["/embed/text"] != 3 || stats.Requests["/embed/image"] != 1 {
+		t.Errorf("unexpected requests %+v", stats)
+	}
+}
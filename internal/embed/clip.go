@@ -1,56 +1,51 @@
 package embed
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
 type CLIPClient struct {
-	BaseURL string
+	BaseURL    string
+	HttpClient *http.Client
+	// retry policy of transient errors
+	Retry RetryPolicy
+	// circuit breaker which pauses requests when service is down
+	Breaker *CircuitBreaker
 }
 
-func (c *CLIPClient) EmbedImage(imageBytes []byte) ([]float32, error) {
-	return c.post("/embed/image", imageBytes)
+func NewCLIPClient(baseURL string) *CLIPClient {
+	return &CLIPClient{
+		BaseURL: baseURL,
+		HttpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		Retry:   DefaultRetryPolicy(),
+		Breaker: NewCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
+	}
 }
 
-func (c *CLIPClient) EmbedText(text string) ([]float32, error) {
-	b, _ := json.Marshal(map[string]string{"text": text})
-	return c.postJSON("/embed/text", b)
+func (c *CLIPClient) EmbedImage(ctx context.Context, imageBytes []byte) ([]float32, error) {
+	return c.post(ctx, "/embed/image", "application/octet-stream", imageBytes)
 }
 
-func (c *CLIPClient) post(path string, raw []byte) ([]float32, error) {
-	resp, err := http.Post(
-		c.BaseURL+path,
-		"application/octet-stream",
-		bytes.NewReader(raw),
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var out struct {
-		Embedding []float32 `json:"embedding"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&out)
-	return out.Embedding, err
+func (c *CLIPClient) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	b, _ := json.Marshal(map[string]string{"text": text})
+	return c.post(ctx, "/embed/text", "application/json", b)
 }
 
-func (c *CLIPClient) postJSON(path string, raw []byte) ([]float32, error) {
-	resp, err := http.Post(
-		c.BaseURL+path,
-		"application/json",
-		bytes.NewReader(raw),
-	)
+func (c *CLIPClient) post(ctx context.Context, path, contentType string, raw []byte) ([]float32, error) {
+	r := requester{client: c.HttpClient, retry: c.Retry, breaker: c.Breaker}
+	body, err := r.do(ctx, "POST", c.BaseURL+path, raw, map[string]string{"Content-Type": contentType})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	var out struct {
 		Embedding []float32 `json:"embedding"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&out)
+	err = json.Unmarshal(body, &out)
 	return out.Embedding, err
 }
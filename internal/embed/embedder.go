@@ -0,0 +1,313 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"cbf2go/internal/cbf"
+)
+
+// Embedder represents method which converts CBF frame to embedding vector
+type Embedder interface {
+	// Name returns method name stored in payload of ingested points
+	Name() string
+	// Dimension returns size of embedding vector, zero means that it is
+	// not known until first embedding is computed (remote services)
+	Dimension() int
+	// Embed returns embedding vector of the frame
+	Embed(ctx context.Context, f *cbf.Frame) ([]float32, error)
+}
+
+// BatchEmbedder represents embedder which can embed several frames at once
+type BatchEmbedder interface {
+	Embedder
+	EmbedBatch(ctx context.Context, frames []*cbf.Frame) ([][]float32, error)
+}
+
+// Options represents options used to create embedders
+type Options struct {
+	URL     string       // URL of embedding service
+	Spec    string       // method parameters, part of method name after colon
+	Gzip    bool         // compress requests to embedding service
+	Retry   *RetryPolicy // retry policy of remote methods, nil means default policy
+	Size    int          // image size used by local embedding
+	Verbose int          // verbosity level
+	// Logf logs events of remote clients, e.g. circuit breaker state
+	// changes, nil disables logging
+	Logf func(format string, args ...any)
+}
+
+// Factory creates new embedder from options
+type Factory func(opts Options) (Embedder, error)
+
+// embedding methods supported by default
+const (
+	MethodImage   = "image2embedding"    // legacy embedding of counts cast to uint8
+	MethodImageV2 = "image2embedding-v2" // embedding of preprocessed counts, see Preprocess
+	MethodResNet  = "resnet"
+	MethodCLIP    = "clip"
+)
+
+// DefaultMethod is used when collection or request does not specify method
+var DefaultMethod = MethodImageV2
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register adds embedding method factory to the registry
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// New creates embedder for given method name. Method parameters may follow
+// the name after colon, e.g. "image2embedding-v2:asinh,p1-99.5", and name of
+// projected method ends with projection suffix, e.g. "|pca256@1a2b3c4d",
+// which refers to projection registered with RegisterProjection.
+func New(name string, opts Options) (Embedder, error) {
+	if base, suffix, ok := strings.Cut(name, "|"); ok {
+		p, err := lookupProjection(suffix)
+		if err != nil {
+			return nil, err
+		}
+		e, err := New(base, opts)
+		if err != nil {
+			return nil, err
+		}
+		return Project(e, p)
+	}
+	name, spec, _ := strings.Cut(name, ":")
+	if spec != "" {
+		opts.Spec = spec
+	}
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown embedding method %q, supported methods: %v", name, Methods())
+	}
+	return factory(opts)
+}
+
+// SupportsMasks reports if embedding method may be used for masked or
+// background subtracted frames. Legacy image2embedding casts counts to uint8
+// like numpy astype, so masked pixels (cbf.MaskedValue) and negative
+// residuals of background subtraction would become the brightest features
+// of the vector.
+func SupportsMasks(method string) bool {
+	base, _, _ := strings.Cut(method, "|")
+	base, _, _ = strings.Cut(base, ":")
+	return base != MethodImage
+}
+
+// Methods returns sorted list of registered embedding methods
+func Methods() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register(MethodImage, func(opts Options) (Embedder, error) {
+		if opts.Size <= 0 {
+			return nil, fmt.Errorf("invalid embedding size %d", opts.Size)
+		}
+		return &ImageEmbedder{Size: opts.Size, Verbose: opts.Verbose}, nil
+	})
+	Register(MethodImageV2, func(opts Options) (Embedder, error) {
+		if opts.Size <= 0 {
+			return nil, fmt.Errorf("invalid embedding size %d", opts.Size)
+		}
+		params, err := ParsePreprocessParams(opts.Spec)
+		if err != nil {
+			return nil, err
+		}
+		return &PreprocessEmbedder{Size: opts.Size, Preprocess: params}, nil
+	})
+	Register(MethodResNet, func(opts Options) (Embedder, error) {
+		if opts.URL == "" {
+			return nil, fmt.Errorf("method %s requires URL of embedding service", MethodResNet)
+		}
+		client := NewEmbedClient(opts.URL)
+		client.Gzip = opts.Gzip
+		client.Breaker.Logf = opts.Logf
+		if opts.Retry != nil {
+			client.Retry = *opts.Retry
+		}
+		return &PixelEmbedder{Method: MethodResNet, Client: client}, nil
+	})
+	Register(MethodCLIP, func(opts Options) (Embedder, error) {
+		if opts.URL == "" {
+			return nil, fmt.Errorf("method %s requires URL of CLIP service", MethodCLIP)
+		}
+		client := NewCLIPClient(opts.URL)
+		client.Breaker.Logf = opts.Logf
+		if opts.Retry != nil {
+			client.Retry = *opts.Retry
+		}
+		return &CLIPEmbedder{Client: client}, nil
+	})
+}
+
+// EmbedFrames returns embeddings of frames using batch call if embedder
+// supports it
+func EmbedFrames(ctx context.Context, e Embedder, frames []*cbf.Frame) ([][]float32, error) {
+	if be, ok := e.(BatchEmbedder); ok {
+		return be.EmbedBatch(ctx, frames)
+	}
+	vecs := make([][]float32, len(frames))
+	for i, f := range frames {
+		vec, err := e.Embed(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+// ImageEmbedder represents local embedding of resized image, see ImageToEmbedding
+type ImageEmbedder struct {
+	Size    int
+	Verbose int
+}
+
+// Name implements Embedder interface
+func (e *ImageEmbedder) Name() string { return MethodImage }
+
+// Dimension implements Embedder interface
+func (e *ImageEmbedder) Dimension() int { return e.Size * e.Size }
+
+// Params implements Parameterized interface
+func (e *ImageEmbedder) Params() string { return fmt.Sprintf("size=%d", e.Size) }
+
+// Embed implements Embedder interface
+func (e *ImageEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	return ImageToEmbedding(f.Pixels, f.Width, f.Height, e.Size, e.Verbose), nil
+}
+
+// PreprocessEmbedder represents local embedding of preprocessed and resized
+// image, see PreprocessedEmbedding. Its name includes preprocessing parameters
+// so embeddings with different preprocessing are never mixed in one collection.
+type PreprocessEmbedder struct {
+	Size       int
+	Preprocess PreprocessParams
+}
+
+// Name implements Embedder interface
+func (e *PreprocessEmbedder) Name() string { return MethodImageV2 + ":" + e.Preprocess.String() }
+
+// Dimension implements Embedder interface
+func (e *PreprocessEmbedder) Dimension() int { return e.Size * e.Size }
+
+// Params implements Parameterized interface
+func (e *PreprocessEmbedder) Params() string { return fmt.Sprintf("size=%d", e.Size) }
+
+// Embed implements Embedder interface
+func (e *PreprocessEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	return PreprocessedEmbedding(f, e.Size, e.Preprocess), nil
+}
+
+// PixelEmbedder represents remote embedding of raw pixels via EmbedClient
+type PixelEmbedder struct {
+	Method string
+	Client *EmbedClient
+	dim    atomic.Int64
+}
+
+// Name implements Embedder interface
+func (e *PixelEmbedder) Name() string { return e.Method }
+
+// Dimension implements Embedder interface
+func (e *PixelEmbedder) Dimension() int { return int(e.dim.Load()) }
+
+// Params implements Parameterized interface
+func (e *PixelEmbedder) Params() string { return "url=" + e.Client.BaseURL }
+
+// Embed implements Embedder interface
+func (e *PixelEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	vecs, err := e.EmbedBatch(ctx, []*cbf.Frame{f})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch implements BatchEmbedder interface
+func (e *PixelEmbedder) EmbedBatch(ctx context.Context, frames []*cbf.Frame) ([][]float32, error) {
+	pframes := make([]PixelFrame, len(frames))
+	for i, f := range frames {
+		pframes[i] = PixelFrame{Pixels: f.Pixels, Width: f.Width, Height: f.Height}
+	}
+	vecs, err := e.Client.EmbedBatch(ctx, pframes)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) > 0 {
+		e.dim.Store(int64(len(vecs[0])))
+	}
+	return vecs, nil
+}
+
+// BatchLimit implements BatchLimiter interface, limit is negotiated with
+// embedding service
+func (e *PixelEmbedder) BatchLimit(ctx context.Context) (int, error) {
+	if e.Client.DisableBatch {
+		return 1, nil
+	}
+	caps, err := e.Client.Capabilities(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !caps.Batch {
+		return 1, nil
+	}
+	return caps.MaxBatch, nil
+}
+
+// CLIPEmbedder represents remote embedding of frame rendered to PNG image via CLIPClient
+type CLIPEmbedder struct {
+	Client *CLIPClient
+	dim    atomic.Int64
+}
+
+// Name implements Embedder interface
+func (e *CLIPEmbedder) Name() string { return MethodCLIP }
+
+// Dimension implements Embedder interface
+func (e *CLIPEmbedder) Dimension() int { return int(e.dim.Load()) }
+
+// Params implements Parameterized interface
+func (e *CLIPEmbedder) Params() string { return "url=" + e.Client.BaseURL }
+
+// Embed implements Embedder interface
+func (e *CLIPEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	img, err := cbf.ColorImage(f.Pixels, f.Width, f.Height)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	vec, err := e.Client.EmbedImage(ctx, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	e.dim.Store(int64(len(vec)))
+	return vec, nil
+}
@@ -0,0 +1,317 @@
+package embed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"cbf2go/internal/cbf"
+)
+
+// compact rotation-invariant embedding methods
+const (
+	MethodRadialProfile = "radial-profile" // azimuthally averaged intensity profile in q
+	MethodHistogram     = "histogram"      // multi-scale intensity histograms
+	MethodRingStats     = "ring-stats"     // per resolution shell background, ring and spot statistics
+)
+
+// resolution range (Angstrom) covered by radial profile and ring statistics,
+// fixed range makes vectors of frames with different geometry comparable
+var FeatureDRange = [2]float64{50, 1.2}
+
+// default sizes of feature embeddings
+var (
+	DefaultProfileBins   = 256
+	DefaultHistogramBins = 64 // per scale
+	DefaultRingShells    = 32
+)
+
+// histogram scales, i.e. sizes of pixel blocks summed before histogramming
+var histogramScales = []int{1, 2, 4, 8}
+
+// number of features computed per resolution shell by ring-stats method
+const ringFeatures = 4
+
+func init() {
+	Register(MethodRadialProfile, func(opts Options) (Embedder, error) {
+		n, err := specSize(opts.Spec, DefaultProfileBins)
+		if err != nil {
+			return nil, err
+		}
+		return &RadialProfileEmbedder{Bins: n}, nil
+	})
+	Register(MethodHistogram, func(opts Options) (Embedder, error) {
+		n, err := specSize(opts.Spec, DefaultHistogramBins)
+		if err != nil {
+			return nil, err
+		}
+		return &HistogramEmbedder{Bins: n}, nil
+	})
+	Register(MethodRingStats, func(opts Options) (Embedder, error) {
+		n, err := specSize(opts.Spec, DefaultRingShells)
+		if err != nil {
+			return nil, err
+		}
+		return &RingStatsEmbedder{Shells: n}, nil
+	})
+}
+
+// specSize parses size from method parameters, empty specification means
+// default size
+func specSize(spec string, def int) (int, error) {
+	if spec == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid method size %q", spec)
+	}
+	return n, nil
+}
+
+// RadialProfileEmbedder represents embedding of azimuthally averaged profile
+// of log counts over FeatureDRange, bins uniform in q
+type RadialProfileEmbedder struct {
+	Bins int
+}
+
+// Name implements Embedder interface
+func (e *RadialProfileEmbedder) Name() string {
+	return fmt.Sprintf("%s:%d", MethodRadialProfile, e.Bins)
+}
+
+// Dimension implements Embedder interface
+func (e *RadialProfileEmbedder) Dimension() int { return e.Bins }
+
+// Embed implements Embedder interface
+func (e *RadialProfileEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	prof, err := cbf.Integrate(f, nil, cbf.IntegrateParams{
+		Unit: cbf.UnitQ,
+		Bins: e.Bins,
+		Min:  cbf.DToQ(FeatureDRange[0]),
+		Max:  cbf.DToQ(FeatureDRange[1]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s requires detector geometry: %w", MethodRadialProfile, err)
+	}
+	vals := make([]float64, e.Bins)
+	valid := make([]bool, e.Bins)
+	for i, b := range prof.Bins {
+		if b.Count > 0 {
+			vals[i] = math.Log1p(math.Max(b.Mean, 0))
+			valid[i] = true
+		}
+	}
+	standardize(vals, valid)
+	return toUnitVector(vals), nil
+}
+
+// HistogramEmbedder represents embedding of histograms of log counts of the
+// frame binned at several scales
+type HistogramEmbedder struct {
+	Bins int // number of bins per scale
+}
+
+// Name implements Embedder interface
+func (e *HistogramEmbedder) Name() string {
+	return fmt.Sprintf("%s:%d", MethodHistogram, e.Bins)
+}
+
+// Dimension implements Embedder interface
+func (e *HistogramEmbedder) Dimension() int { return e.Bins * len(histogramScales) }
+
+// Embed implements Embedder interface
+func (e *HistogramEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	vals := make([]float64, 0, e.Dimension())
+	for _, s := range histogramScales {
+		vals = append(vals, scaleHistogram(f, s, e.Bins)...)
+	}
+	return toUnitVector(vals), nil
+}
+
+// scaleHistogram sums counts of s x s pixel blocks without masked pixels and
+// returns square root of fractions of blocks in bins of log2(1+sum). Bins
+// cover 0..2^24 counts per pixel, higher counts go to the last bin.
+func scaleHistogram(f *cbf.Frame, s, nbins int) []float64 {
+	hist := make([]float64, nbins)
+	top := math.Log2(1 + float64(s*s)*(1<<24))
+	var total float64
+	for by := 0; by+s <= f.Height; by += s {
+		for bx := 0; bx+s <= f.Width; bx += s {
+			var sum float64
+			masked := false
+			for y := by; y < by+s && !masked; y++ {
+				for x := bx; x < bx+s; x++ {
+					v := f.Pixels[y*f.Width+x]
+					if v < 0 {
+						masked = true
+						break
+					}
+					sum += float64(v)
+				}
+			}
+			if masked {
+				continue
+			}
+			k := min(int(math.Log2(1+sum)/top*float64(nbins)), nbins-1)
+			hist[k]++
+			total++
+		}
+	}
+	if total > 0 {
+		for i := range hist {
+			hist[i] = math.Sqrt(hist[i] / total)
+		}
+	}
+	return hist
+}
+
+// RingStatsEmbedder represents embedding of statistics of resolution shells
+// uniform in 1/d^2 over FeatureDRange: log of mean counts, azimuthal
+// variation of counts, number of spots and mean spot intensity
+type RingStatsEmbedder struct {
+	Shells int
+}
+
+// Name implements Embedder interface
+func (e *RingStatsEmbedder) Name() string {
+	return fmt.Sprintf("%s:%d", MethodRingStats, e.Shells)
+}
+
+// Dimension implements Embedder interface
+func (e *RingStatsEmbedder) Dimension() int { return e.Shells * ringFeatures }
+
+// Embed implements Embedder interface
+func (e *RingStatsEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	if !f.Meta.HasGeometry() {
+		return nil, fmt.Errorf("%s requires detector geometry", MethodRingStats)
+	}
+	n := e.Shells
+	lo := 1 / (FeatureDRange[0] * FeatureDRange[0])
+	hi := 1 / (FeatureDRange[1] * FeatureDRange[1])
+	shell := func(d float64) int {
+		if d <= 0 || math.IsInf(d, 0) {
+			return -1
+		}
+		k := int((1/(d*d) - lo) / (hi - lo) * float64(n))
+		if k < 0 || k >= n {
+			return -1
+		}
+		return k
+	}
+
+	// pixel statistics per shell
+	sum := make([]float64, n)
+	sum2 := make([]float64, n)
+	count := make([]float64, n)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			v := f.Pixels[y*f.Width+x]
+			if v < 0 || f.Overloaded(v) {
+				continue
+			}
+			k := shell(f.Resolution(x, y))
+			if k < 0 {
+				continue
+			}
+			sum[k] += float64(v)
+			sum2[k] += float64(v) * float64(v)
+			count[k]++
+		}
+	}
+
+	// spot statistics per shell
+	nspots := make([]float64, n)
+	spotSum := make([]float64, n)
+	for _, s := range cbf.FindSpots(f, nil, cbf.DefaultSpotParams()) {
+		k := shell(f.Resolution(int(s.X), int(s.Y)))
+		if k < 0 {
+			continue
+		}
+		nspots[k]++
+		spotSum[k] += float64(s.Intensity)
+	}
+
+	blocks := make([][]float64, ringFeatures)
+	valid := make([]bool, n)
+	for i := range blocks {
+		blocks[i] = make([]float64, n)
+	}
+	for k := 0; k < n; k++ {
+		if count[k] == 0 {
+			continue
+		}
+		valid[k] = true
+		mean := sum[k] / count[k]
+		blocks[0][k] = math.Log1p(mean)
+		if mean > 0 {
+			std := math.Sqrt(math.Max(sum2[k]/count[k]-mean*mean, 0))
+			blocks[1][k] = std / mean
+		}
+		blocks[2][k] = math.Log1p(nspots[k])
+		if nspots[k] > 0 {
+			blocks[3][k] = math.Log1p(spotSum[k] / nspots[k])
+		}
+	}
+
+	// every feature is standardized over shells and has equal weight
+	vals := make([]float64, 0, e.Dimension())
+	for _, b := range blocks {
+		standardize(b, valid)
+		normalize64(b)
+		vals = append(vals, b...)
+	}
+	return toUnitVector(vals), nil
+}
+
+// standardize subtracts mean and divides by standard deviation of valid
+// values, invalid values are set to zero
+func standardize(vals []float64, valid []bool) {
+	var sum, sum2, n float64
+	for i, v := range vals {
+		if valid[i] {
+			sum += v
+			sum2 += v * v
+			n++
+		}
+	}
+	if n == 0 {
+		clear(vals)
+		return
+	}
+	mean := sum / n
+	std := math.Sqrt(math.Max(sum2/n-mean*mean, 0))
+	for i, v := range vals {
+		switch {
+		case !valid[i]:
+			vals[i] = 0
+		case std > 0:
+			vals[i] = (v - mean) / std
+		default:
+			vals[i] = 0
+		}
+	}
+}
+
+// normalize64 scales vector to unit L2 norm
+func normalize64(vals []float64) {
+	var norm float64
+	for _, v := range vals {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm) + 1e-12
+	for i := range vals {
+		vals[i] /= norm
+	}
+}
+
+// toUnitVector converts values to L2 normalized float32 vector
+func toUnitVector(vals []float64) []float32 {
+	vec := make([]float32, len(vals))
+	for i, v := range vals {
+		vec[i] = float32(v)
+	}
+	normalize(vec)
+	return vec
+}
@@ -0,0 +1,151 @@
+package embed_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
+)
+
+// featureFrame returns small frame with detector geometry, noisy background,
+// a powder ring at about 3.9 A and a few spots
+func featureFrame(seed int64) *cbf.Frame {
+	w, h := 96, 96
+	f := &cbf.Frame{
+		Pixels: make([]int32, w*h),
+		Width:  w,
+		Height: h,
+		Meta: cbf.Metadata{
+			PixelSizeX:       172e-6,
+			PixelSizeY:       172e-6,
+			Wavelength:       1,
+			DetectorDistance: 0.02,
+			BeamX:            48,
+			BeamY:            48,
+			CountCutoff:      1 << 20,
+		},
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r := math.Hypot(float64(x-48), float64(y-48))
+			v := 5 + rng.Intn(5) + int(200*math.Exp(-(r-30)*(r-30)/4))
+			f.Pixels[y*w+x] = int32(v)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		x, y := 10+rng.Intn(76), 10+rng.Intn(76)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				f.Pixels[(y+dy)*w+x+dx] += 2000
+			}
+		}
+	}
+	return f
+}
+
+// featureMethods are compact embedding methods with small sizes
+var featureMethods = []string{embed.MethodRadialProfile + ":32", embed.MethodHistogram + ":16", embed.MethodRingStats + ":8"}
+
+func TestFeatureEmbedders(t *testing.T) {
+	ctx := context.Background()
+	for _, method := range featureMethods {
+		e, err := embed.New(method, embed.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Name() != method {
+			t.Errorf("expected name %s, got %s", method, e.Name())
+		}
+		a, err := e.Embed(ctx, featureFrame(1))
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if len(a) != e.Dimension() {
+			t.Errorf("%s: vector size %d, expected %d", method, len(a), e.Dimension())
+		}
+		var norm float64
+		for _, v := range a {
+			if math.IsNaN(float64(v)) {
+				t.Fatalf("%s: NaN in vector", method)
+			}
+			norm += float64(v) * float64(v)
+		}
+		if math.Abs(norm-1) > 1e-4 {
+			t.Errorf("%s: expected unit vector, got norm %f", method, math.Sqrt(norm))
+		}
+
+		// the same frame gives the same vector, other frame a different one
+		b, err := e.Embed(ctx, featureFrame(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%s: embedding is not deterministic", method)
+		}
+		c, err := e.Embed(ctx, featureFrame(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(a, c) {
+			t.Errorf("%s: different frames have the same embedding", method)
+		}
+	}
+}
+
+func TestFeatureEmbeddersMask(t *testing.T) {
+	ctx := context.Background()
+	// hot pixels change the embedding, masked ones are ignored regardless
+	// of their negative value
+	hot, gap, bad := featureFrame(1), featureFrame(1), featureFrame(1)
+	for y := 20; y < 30; y++ {
+		for x := 60; x < 64; x++ {
+			i := y*hot.Width + x
+			hot.Pixels[i] = 50000
+			gap.Pixels[i] = -1
+			bad.Pixels[i] = -2
+		}
+	}
+	for _, method := range featureMethods {
+		e, err := embed.New(method, embed.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecs := make([][]float32, 3)
+		for i, f := range []*cbf.Frame{hot, gap, bad} {
+			if vecs[i], err = e.Embed(ctx, f); err != nil {
+				t.Fatalf("%s: %v", method, err)
+			}
+		}
+		if !reflect.DeepEqual(vecs[1], vecs[2]) {
+			t.Errorf("%s: values of masked pixels change embedding", method)
+		}
+		if reflect.DeepEqual(vecs[0], vecs[1]) {
+			t.Errorf("%s: masked pixels are not excluded", method)
+		}
+	}
+}
+
+func TestFeatureEmbeddersGeometry(t *testing.T) {
+	f := featureFrame(1)
+	f.Meta = cbf.Metadata{}
+	for _, method := range featureMethods {
+		e, err := embed.New(method, embed.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = e.Embed(context.Background(), f)
+		// histogram does not depend on detector geometry
+		if wantErr := !strings.HasPrefix(method, embed.MethodHistogram); (err != nil) != wantErr {
+			t.Errorf("%s: unexpected error %v without geometry", method, err)
+		}
+	}
+	if _, err := embed.New(embed.MethodHistogram+":0", embed.Options{}); err == nil {
+		t.Error("expected error of invalid method size")
+	}
+}
@@ -0,0 +1,309 @@
+// Package mock provides stand-in embedding service implementing endpoints
+// used by embed.EmbedClient and embed.CLIPClient. Embeddings are
+// deterministic, latency and failures can be injected to exercise retries
+// and batch ingestion without real models.
+package mock
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
+)
+
+// Config represents mock service configuration
+type Config struct {
+	Dim         int           `json:"dim"`          // embedding dimension
+	Latency     time.Duration `json:"latency"`      // delay of every response
+	Jitter      time.Duration `json:"jitter"`       // random extra delay up to this value
+	ErrorRate   float64       `json:"error_rate"`   // probability of injected failure
+	ErrorStatus int           `json:"error_status"` // HTTP status of injected failures
+	FailFirst   int           `json:"fail_first"`   // number of first embedding requests which fail
+	Batch       bool          `json:"batch"`        // support binary batch protocol
+	MaxBatch    int           `json:"max_batch"`    // maximum batch size announced to clients
+	Seed        int64         `json:"seed"`         // seed of latency jitter and failure injection
+}
+
+// DefaultConfig returns default mock service configuration
+func DefaultConfig() Config {
+	return Config{
+		Dim:         256,
+		ErrorStatus: http.StatusServiceUnavailable,
+		Batch:       true,
+		MaxBatch:    16,
+		Seed:        1,
+	}
+}
+
+// Stats represents number of requests served by mock service
+type Stats struct {
+	Requests map[string]int `json:"requests"` // requests per endpoint
+	Failures int            `json:"failures"` // injected failures
+	Frames   int            `json:"frames"`   // embedded frames
+}
+
+// Handler represents mock embedding service
+type Handler struct {
+	Config Config
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	stats Stats
+	mux   *http.ServeMux
+}
+
+// NewHandler returns mock service handler, it can be served by
+// httptest.NewServer or http.ListenAndServe
+func NewHandler(cfg Config) *Handler {
+	if cfg.Dim <= 0 {
+		cfg.Dim = DefaultConfig().Dim
+	}
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = DefaultConfig().ErrorStatus
+	}
+	h := &Handler{
+		Config: cfg,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		stats:  Stats{Requests: make(map[string]int)},
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /capabilities", h.capabilities)
+	h.mux.HandleFunc("GET /stats", h.statsHandler)
+	h.mux.HandleFunc("POST /embed/pixels", h.embedPixels)
+	h.mux.HandleFunc("POST /embed/batch", h.embedBatch)
+	h.mux.HandleFunc("POST /embed/image", h.embedImage)
+	h.mux.HandleFunc("POST /embed/text", h.embedText)
+	return h
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Stats returns copy of request statistics
+func (h *Handler) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := h.stats
+	out.Requests = make(map[string]int, len(h.stats.Requests))
+	for k, v := range h.stats.Requests {
+		out.Requests[k] = v
+	}
+	return out
+}
+
+// begin records request, waits for configured latency and decides if
+// request should fail, it returns false if response is already written
+func (h *Handler) begin(w http.ResponseWriter, r *http.Request) bool {
+	h.mu.Lock()
+	h.stats.Requests[r.URL.Path]++
+	delay := h.Config.Latency
+	if h.Config.Jitter > 0 {
+		delay += time.Duration(h.rng.Int63n(int64(h.Config.Jitter)))
+	}
+	fail := h.Config.ErrorRate > 0 && h.rng.Float64() < h.Config.ErrorRate
+	embeddings := 0
+	for path, n := range h.stats.Requests {
+		if path != "/capabilities" && path != "/stats" {
+			embeddings += n
+		}
+	}
+	if embeddings <= h.Config.FailFirst {
+		fail = true
+	}
+	if fail {
+		h.stats.Failures++
+	}
+	h.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+	if fail {
+		writeJSON(w, h.Config.ErrorStatus, map[string]string{"error": "injected failure"})
+		return false
+	}
+	return true
+}
+
+// capabilities announces supported protocols
+func (h *Handler) capabilities(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.stats.Requests[r.URL.Path]++
+	h.mu.Unlock()
+	if !h.Config.Batch {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, embed.Capabilities{
+		Batch:     true,
+		DTypes:    []string{"int32", "float32"},
+		Encodings: []string{"gzip"},
+		MaxBatch:  h.Config.MaxBatch,
+	})
+}
+
+// statsHandler returns request statistics
+func (h *Handler) statsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Stats())
+}
+
+// embedPixels handles JSON pixel requests of EmbedClient
+func (h *Handler) embedPixels(w http.ResponseWriter, r *http.Request) {
+	if !h.begin(w, r) {
+		return
+	}
+	var req embed.PixelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(req.Pixels) != req.Width*req.Height || len(req.Pixels) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("pixel count mismatch: %d vs %dx%d", len(req.Pixels), req.Width, req.Height)})
+		return
+	}
+	pixels := make([]int32, len(req.Pixels))
+	for i, v := range req.Pixels {
+		pixels[i] = int32(math.Round(float64(v)))
+	}
+	vec := h.frameEmbedding(pixels, req.Width, req.Height)
+	writeJSON(w, http.StatusOK, embed.EmbedResponse{Embedding: vec, Dim: len(vec)})
+}
+
+// embedBatch handles binary batch requests of EmbedClient
+func (h *Handler) embedBatch(w http.ResponseWriter, r *http.Request) {
+	if !h.Config.Batch || r.Header.Get("Content-Type") != embed.BatchContentType {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "batch protocol is not supported"})
+		return
+	}
+	if !h.begin(w, r) {
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	frames, err := embed.DecodeBatch(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	out := embed.BatchResponse{Dim: h.Config.Dim}
+	for _, f := range frames {
+		out.Embeddings = append(out.Embeddings, h.frameEmbedding(f.Pixels, f.Width, f.Height))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// embedImage handles image requests of CLIPClient, PNG and JPEG images are
+// embedded by content and other payloads by hash
+func (h *Handler) embedImage(w http.ResponseWriter, r *http.Request) {
+	if !h.begin(w, r) {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	var vec []float32
+	if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		b := img.Bounds()
+		pixels := make([]int32, b.Dx()*b.Dy())
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				rr, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				pixels[y*b.Dx()+x] = int32((rr + g + bl) / 3 >> 8)
+			}
+		}
+		vec = h.frameEmbedding(pixels, b.Dx(), b.Dy())
+	} else {
+		vec = hashEmbedding(data, h.Config.Dim)
+	}
+	writeJSON(w, http.StatusOK, embed.EmbedResponse{Embedding: vec, Dim: len(vec)})
+}
+
+// embedText handles text requests of CLIPClient
+func (h *Handler) embedText(w http.ResponseWriter, r *http.Request) {
+	if !h.begin(w, r) {
+		return
+	}
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	vec := hashEmbedding([]byte(req.Text), h.Config.Dim)
+	writeJSON(w, http.StatusOK, embed.EmbedResponse{Embedding: vec, Dim: len(vec)})
+}
+
+// frameEmbedding returns deterministic embedding of pixels computed with
+// built-in preprocessing embedder, similar frames have similar embeddings
+func (h *Handler) frameEmbedding(pixels []int32, width, height int) []float32 {
+	h.mu.Lock()
+	h.stats.Frames++
+	h.mu.Unlock()
+	dim := h.Config.Dim
+	side := int(math.Ceil(math.Sqrt(float64(dim))))
+	f := &cbf.Frame{Pixels: pixels, Width: width, Height: height}
+	vec := embed.PreprocessedEmbedding(f, side, embed.DefaultPreprocessParams())[:dim]
+	return unit(vec)
+}
+
+// hashEmbedding returns pseudo-random unit vector seeded by SHA-256 of data
+func hashEmbedding(data []byte, dim int) []float32 {
+	sum := sha256.Sum256(data)
+	rng := rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(sum[:8]))))
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = float32(rng.NormFloat64())
+	}
+	return unit(vec)
+}
+
+// unit normalizes vector to unit L2 norm
+func unit(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	norm = math.Sqrt(norm) + 1e-8
+	for i := range vec {
+		vec[i] /= float32(norm)
+	}
+	return vec
+}
+
+// writeJSON writes JSON response with given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
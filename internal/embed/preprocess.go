@@ -0,0 +1,172 @@
+package embed
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cbf2go/internal/cbf"
+)
+
+// Compression represents dynamic range compression of pixel counts
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"
+	CompressionLog   Compression = "log"   // log(1+v)
+	CompressionAsinh Compression = "asinh" // asinh(v/s), s is median of valid pixels
+)
+
+// PreprocessParams represents preprocessing pipeline of the built-in embedder:
+// gaps, bad and overloaded pixels are masked, counts are compressed, clipped
+// at percentiles of valid pixels and normalized to [0,1]
+type PreprocessParams struct {
+	Compression Compression `json:"compression"`
+	ClipLow     float64     `json:"clip_low"`  // lower clipping percentile
+	ClipHigh    float64     `json:"clip_high"` // upper clipping percentile
+}
+
+// DefaultPreprocessParams returns default preprocessing parameters
+func DefaultPreprocessParams() PreprocessParams {
+	return PreprocessParams{
+		Compression: CompressionLog,
+		ClipLow:     0,
+		ClipHigh:    99.9,
+	}
+}
+
+// String returns canonical specification of preprocessing parameters used
+// in method names, e.g. "log,p0-99.9"
+func (p PreprocessParams) String() string {
+	return fmt.Sprintf("%s,p%s-%s", p.Compression,
+		strconv.FormatFloat(p.ClipLow, 'g', -1, 64),
+		strconv.FormatFloat(p.ClipHigh, 'g', -1, 64))
+}
+
+// ParsePreprocessParams parses specification produced by String, missing
+// parts take default values
+func ParsePreprocessParams(spec string) (PreprocessParams, error) {
+	p := DefaultPreprocessParams()
+	if spec == "" {
+		return p, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		switch c := Compression(part); c {
+		case CompressionNone, CompressionLog, CompressionAsinh:
+			p.Compression = c
+			continue
+		}
+		lo, hi, ok := strings.Cut(strings.TrimPrefix(part, "p"), "-")
+		if !strings.HasPrefix(part, "p") || !ok {
+			return p, fmt.Errorf("invalid preprocessing option %q", part)
+		}
+		var err error
+		if p.ClipLow, err = strconv.ParseFloat(lo, 64); err != nil {
+			return p, fmt.Errorf("invalid clipping percentile %q: %w", lo, err)
+		}
+		if p.ClipHigh, err = strconv.ParseFloat(hi, 64); err != nil {
+			return p, fmt.Errorf("invalid clipping percentile %q: %w", hi, err)
+		}
+	}
+	if p.ClipLow < 0 || p.ClipHigh > 100 || p.ClipLow >= p.ClipHigh {
+		return p, fmt.Errorf("invalid clipping percentiles %v-%v", p.ClipLow, p.ClipHigh)
+	}
+	return p, nil
+}
+
+// Preprocess converts frame counts to values in [0,1]. Masked pixels (gaps
+// and bad pixels) become 0 and overloaded pixels become 1.
+func Preprocess(f *cbf.Frame, p PreprocessParams) []float32 {
+	out := make([]float32, len(f.Pixels))
+	var valid []float64
+	for _, v := range f.Pixels {
+		if v >= 0 && !f.Overloaded(v) {
+			valid = append(valid, float64(v))
+		}
+	}
+	if len(valid) == 0 {
+		return out
+	}
+	slices.Sort(valid)
+
+	compress := func(v float64) float64 { return v }
+	switch p.Compression {
+	case CompressionLog:
+		compress = math.Log1p
+	case CompressionAsinh:
+		s := math.Max(valid[len(valid)/2], 1)
+		compress = func(v float64) float64 { return math.Asinh(v / s) }
+	}
+	// compression is monotonic, so percentiles can be taken from sorted counts
+	lo := compress(sortedPercentile(valid, p.ClipLow))
+	hi := compress(sortedPercentile(valid, p.ClipHigh))
+	scale := 0.0
+	if hi > lo {
+		scale = 1 / (hi - lo)
+	}
+
+	for i, v := range f.Pixels {
+		switch {
+		case v < 0:
+			out[i] = 0
+		case f.Overloaded(v):
+			out[i] = 1
+		default:
+			t := (compress(float64(v)) - lo) * scale
+			out[i] = float32(math.Min(math.Max(t, 0), 1))
+		}
+	}
+	return out
+}
+
+// sortedPercentile returns linearly interpolated percentile of sorted values
+func sortedPercentile(vals []float64, pct float64) float64 {
+	pos := pct / 100 * float64(len(vals)-1)
+	i := int(pos)
+	if i+1 >= len(vals) {
+		return vals[len(vals)-1]
+	}
+	t := pos - float64(i)
+	return vals[i]*(1-t) + vals[i+1]*t
+}
+
+// PreprocessedEmbedding returns L2 normalized embedding of preprocessed frame
+// resized to size x size image
+func PreprocessedEmbedding(f *cbf.Frame, size int, p PreprocessParams) []float32 {
+	vals := Preprocess(f, p)
+	w, h := f.Width, f.Height
+	vec := make([]float32, size*size)
+	sx := float64(w) / float64(size)
+	sy := float64(h) / float64(size)
+	for y := 0; y < size; y++ {
+		fy := float64(y) * sy
+		y0 := int(fy)
+		y1 := min(y0+1, h-1)
+		wy := float32(fy - float64(y0))
+		for x := 0; x < size; x++ {
+			fx := float64(x) * sx
+			x0 := int(fx)
+			x1 := min(x0+1, w-1)
+			wx := float32(fx - float64(x0))
+			v0 := vals[y0*w+x0]*(1-wx) + vals[y0*w+x1]*wx
+			v1 := vals[y1*w+x0]*(1-wx) + vals[y1*w+x1]*wx
+			vec[y*size+x] = v0*(1-wy) + v1*wy
+		}
+	}
+	normalize(vec)
+	return vec
+}
+
+// normalize scales vector to unit L2 norm
+func normalize(vec []float32) {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	norm = math.Sqrt(norm) + 1e-8
+	for i := range vec {
+		vec[i] /= float32(norm)
+	}
+}
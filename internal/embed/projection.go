@@ -0,0 +1,583 @@
+package embed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"cbf2go/internal/cbf"
+)
+
+// projection types
+const (
+	ProjectionPCA    = "pca"
+	ProjectionRandom = "random"
+)
+
+// Projection represents linear dimensionality reduction of embedding vectors
+// produced by Source method. Random projections are regenerated from the
+// seed and their matrix is not stored in projection file.
+type Projection struct {
+	Type      string    `json:"type"`   // pca or random
+	Source    string    `json:"source"` // name of embedding method of input vectors
+	InputDim  int       `json:"input_dim"`
+	OutputDim int       `json:"output_dim"`
+	Seed      int64     `json:"seed,omitempty"`
+	Mean      []float32 `json:"mean,omitempty"`      // mean of fitted vectors subtracted before projection
+	Matrix    []float32 `json:"matrix,omitempty"`    // OutputDim x InputDim matrix, row major
+	Explained []float64 `json:"explained,omitempty"` // fraction of variance explained by PCA components
+}
+
+// NewRandomProjection returns seeded Gaussian random projection
+func NewRandomProjection(source string, inputDim, outputDim int, seed int64) *Projection {
+	p := &Projection{
+		Type:      ProjectionRandom,
+		Source:    source,
+		InputDim:  inputDim,
+		OutputDim: outputDim,
+		Seed:      seed,
+	}
+	p.generate()
+	return p
+}
+
+// generate fills matrix of random projection from the seed
+func (p *Projection) generate() {
+	rng := rand.New(rand.NewSource(p.Seed))
+	scale := 1 / math.Sqrt(float64(p.OutputDim))
+	p.Matrix = make([]float32, p.OutputDim*p.InputDim)
+	for i := range p.Matrix {
+		p.Matrix[i] = float32(rng.NormFloat64() * scale)
+	}
+}
+
+// FitPCA fits principal components of sample vectors. Depending on sample
+// size and vector dimension it diagonalizes either covariance or Gram matrix
+// of the sample, so it can be used for very long vectors with small samples.
+func FitPCA(source string, vecs [][]float32, outputDim int) (*Projection, error) {
+	n := len(vecs)
+	if n < 2 {
+		return nil, fmt.Errorf("at least 2 vectors are required to fit PCA, got %d", n)
+	}
+	d := len(vecs[0])
+	for _, v := range vecs {
+		if len(v) != d {
+			return nil, fmt.Errorf("vector size mismatch: %d vs %d", len(v), d)
+		}
+	}
+	if outputDim > min(n-1, d) {
+		return nil, fmt.Errorf("output dimension %d exceeds rank of the sample %d", outputDim, min(n-1, d))
+	}
+
+	// center vectors
+	mean := make([]float64, d)
+	for _, v := range vecs {
+		for j, x := range v {
+			mean[j] += float64(x)
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(n)
+	}
+	// centered sample is kept as float32, sums are accumulated as float64
+	x := make([][]float32, n)
+	for i, v := range vecs {
+		x[i] = make([]float32, d)
+		for j, val := range v {
+			x[i][j] = float32(float64(val) - mean[j])
+		}
+	}
+
+	p := &Projection{
+		Type:      ProjectionPCA,
+		Source:    source,
+		InputDim:  d,
+		OutputDim: outputDim,
+		Mean:      make([]float32, d),
+		Matrix:    make([]float32, outputDim*d),
+		Explained: make([]float64, outputDim),
+	}
+	for j, m := range mean {
+		p.Mean[j] = float32(m)
+	}
+
+	var vals []float64
+	if d <= n {
+		// covariance matrix d x d, its eigenvectors are components
+		cov := make([]float64, d*d)
+		for _, row := range x {
+			for a := 0; a < d; a++ {
+				if row[a] == 0 {
+					continue
+				}
+				ra := float64(row[a])
+				for b := a; b < d; b++ {
+					cov[a*d+b] += ra * float64(row[b])
+				}
+			}
+		}
+		for a := 0; a < d; a++ {
+			for b := a; b < d; b++ {
+				cov[b*d+a] = cov[a*d+b]
+			}
+		}
+		var vecs [][]float64
+		vals, vecs = symmetricEigen(cov, d)
+		for k := 0; k < outputDim; k++ {
+			for j := 0; j < d; j++ {
+				p.Matrix[k*d+j] = float32(vecs[k][j])
+			}
+		}
+	} else {
+		// Gram matrix n x n, components are X^T u / |X^T u|
+		gram := make([]float64, n*n)
+		for a := 0; a < n; a++ {
+			for b := a; b < n; b++ {
+				var s float64
+				for j := 0; j < d; j++ {
+					s += float64(x[a][j]) * float64(x[b][j])
+				}
+				gram[a*n+b] = s
+				gram[b*n+a] = s
+			}
+		}
+		var us [][]float64
+		vals, us = symmetricEigen(gram, n)
+		comp := make([]float64, d)
+		for k := 0; k < outputDim; k++ {
+			clear(comp)
+			for i := 0; i < n; i++ {
+				for j := 0; j < d; j++ {
+					comp[j] += float64(x[i][j]) * us[k][i]
+				}
+			}
+			var norm float64
+			for _, c := range comp {
+				norm += c * c
+			}
+			norm = math.Sqrt(norm) + 1e-12
+			for j, c := range comp {
+				p.Matrix[k*d+j] = float32(c / norm)
+			}
+		}
+	}
+
+	var total float64
+	for _, v := range vals {
+		total += math.Max(v, 0)
+	}
+	if total > 0 {
+		for k := 0; k < outputDim; k++ {
+			p.Explained[k] = math.Max(vals[k], 0) / total
+		}
+	}
+	return p, nil
+}
+
+// symmetricEigen computes eigenvalues and eigenvectors of symmetric n x n
+// matrix with cyclic Jacobi method, results are sorted by decreasing
+// eigenvalue. Input matrix is destroyed.
+func symmetricEigen(a []float64, n int) ([]float64, [][]float64) {
+	v := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		v[i*n+i] = 1
+	}
+	for sweep := 0; sweep < 100; sweep++ {
+		var off, diag float64
+		for i := 0; i < n; i++ {
+			diag += a[i*n+i] * a[i*n+i]
+			for j := i + 1; j < n; j++ {
+				off += a[i*n+j] * a[i*n+j]
+			}
+		}
+		if off <= 1e-22*diag || off == 0 {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				apq := a[p*n+q]
+				if apq == 0 {
+					continue
+				}
+				theta := (a[q*n+q] - a[p*n+p]) / (2 * apq)
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					akp, akq := a[k*n+p], a[k*n+q]
+					a[k*n+p] = c*akp - s*akq
+					a[k*n+q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p*n+k], a[q*n+k]
+					a[p*n+k] = c*apk - s*aqk
+					a[q*n+k] = s*apk + c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k*n+p], v[k*n+q]
+					v[k*n+p] = c*vkp - s*vkq
+					v[k*n+q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return a[order[i]*n+order[i]] > a[order[j]*n+order[j]] })
+	vals := make([]float64, n)
+	vecs := make([][]float64, n)
+	for k, i := range order {
+		vals[k] = a[i*n+i]
+		vecs[k] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			vecs[k][j] = v[j*n+i]
+		}
+	}
+	return vals, vecs
+}
+
+// ID returns short identifier of the projection derived from its parameters
+// and matrix, it is part of the name of projected embedding method
+func (p *Projection) ID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%d", p.Type, p.Source, p.InputDim, p.OutputDim, p.Seed)
+	if p.Type != ProjectionRandom {
+		binary.Write(h, binary.LittleEndian, p.Mean)
+		binary.Write(h, binary.LittleEndian, p.Matrix)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// Suffix returns suffix added to source method name, e.g. "|pca256@1a2b3c4d"
+func (p *Projection) Suffix() string {
+	return fmt.Sprintf("|%s%d@%s", p.Type, p.OutputDim, p.ID())
+}
+
+// Apply projects vector and normalizes result to unit L2 norm
+func (p *Projection) Apply(vec []float32) ([]float32, error) {
+	if len(vec) != p.InputDim {
+		return nil, fmt.Errorf("projection input size mismatch: %d vs %d", len(vec), p.InputDim)
+	}
+	x := vec
+	if len(p.Mean) == p.InputDim {
+		x = make([]float32, len(vec))
+		for j, v := range vec {
+			x[j] = v - p.Mean[j]
+		}
+	}
+	out := make([]float32, p.OutputDim)
+	for k := range out {
+		row := p.Matrix[k*p.InputDim : (k+1)*p.InputDim]
+		var s float64
+		for j, v := range x {
+			s += float64(row[j] * v)
+		}
+		out[k] = float32(s)
+	}
+	normalize(out)
+	return out, nil
+}
+
+// magic bytes of binary projection file
+var projectionMagic = []byte("CBFPROJ1")
+
+// maximum size of JSON header of binary projection file
+const maxProjectionHeader = 1 << 20
+
+// projectionHeader represents JSON header of binary projection file, mean
+// and matrix follow it as little-endian float32 arrays of given sizes
+type projectionHeader struct {
+	*Projection
+	MeanSize   int `json:"mean_size"`
+	MatrixSize int `json:"matrix_size"`
+}
+
+// SaveProjection writes projection to binary file: magic bytes, uint32
+// size of JSON header, JSON header and raw float32 mean and matrix. Matrix
+// of random projection is not stored.
+func SaveProjection(path string, p *Projection) error {
+	meta := *p
+	meta.Mean, meta.Matrix = nil, nil
+	hdr := projectionHeader{Projection: &meta, MeanSize: len(p.Mean)}
+	if p.Type != ProjectionRandom {
+		hdr.MatrixSize = len(p.Matrix)
+	}
+	data, err := json.Marshal(hdr)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(file, 1<<20)
+	w.Write(projectionMagic)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+	writeFloats(w, p.Mean)
+	writeFloats(w, p.Matrix[:hdr.MatrixSize])
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadProjection reads projection file written by SaveProjection, JSON
+// files of earlier versions are supported too
+func LoadProjection(path string) (*Projection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(file, 1<<20)
+	var p Projection
+	if magic, err := r.Peek(len(projectionMagic)); err == nil && bytes.Equal(magic, projectionMagic) {
+		if err := readProjection(r, &p); err != nil {
+			return nil, fmt.Errorf("failed to read projection %s: %w", path, err)
+		}
+	} else if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse projection %s: %w", path, err)
+	}
+	switch p.Type {
+	case ProjectionRandom:
+		p.generate()
+	case ProjectionPCA:
+		if len(p.Matrix) != p.OutputDim*p.InputDim {
+			return nil, fmt.Errorf("projection %s matrix size mismatch: %d vs %d", path, len(p.Matrix), p.OutputDim*p.InputDim)
+		}
+	default:
+		return nil, fmt.Errorf("projection %s has unsupported type %q", path, p.Type)
+	}
+	return &p, nil
+}
+
+// readProjection reads binary projection
+func readProjection(r io.Reader, p *Projection) error {
+	if _, err := io.ReadFull(r, make([]byte, len(projectionMagic))); err != nil {
+		return err
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return err
+	}
+	if size > maxProjectionHeader {
+		return fmt.Errorf("invalid header size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	hdr := projectionHeader{Projection: p}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return err
+	}
+	// sizes are validated before allocation, header may be corrupted
+	if hdr.MeanSize < 0 || hdr.MeanSize > p.InputDim || hdr.MatrixSize < 0 || hdr.MatrixSize > p.InputDim*p.OutputDim {
+		return fmt.Errorf("invalid mean size %d or matrix size %d", hdr.MeanSize, hdr.MatrixSize)
+	}
+	var err error
+	if p.Mean, err = readFloats(r, hdr.MeanSize); err != nil {
+		return err
+	}
+	p.Matrix, err = readFloats(r, hdr.MatrixSize)
+	return err
+}
+
+// writeFloats writes little-endian float32 values
+func writeFloats(w io.Writer, vals []float32) error {
+	buf := make([]byte, 4*min(len(vals), 1<<16))
+	for len(vals) > 0 {
+		n := min(len(vals), len(buf)/4)
+		for i, v := range vals[:n] {
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+		}
+		if _, err := w.Write(buf[:4*n]); err != nil {
+			return err
+		}
+		vals = vals[n:]
+	}
+	return nil
+}
+
+// readFloats reads n little-endian float32 values, nil is returned for n=0
+func readFloats(r io.Reader, n int) ([]float32, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	out := make([]float32, n)
+	buf := make([]byte, 4*min(n, 1<<16))
+	for off := 0; off < n; {
+		m := min(n-off, len(buf)/4)
+		if _, err := io.ReadFull(r, buf[:4*m]); err != nil {
+			return nil, err
+		}
+		for i := 0; i < m; i++ {
+			out[off+i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+		}
+		off += m
+	}
+	return out, nil
+}
+
+var (
+	projectionsMu sync.RWMutex
+	projections   = make(map[string]*Projection)
+)
+
+// RegisterProjection makes projection available to New, embedding method
+// names with projection suffix are resolved by projection ID
+func RegisterProjection(p *Projection) {
+	projectionsMu.Lock()
+	defer projectionsMu.Unlock()
+	projections[p.ID()] = p
+}
+
+// lookupProjection returns registered projection for method name suffix
+// without leading "|", e.g. "pca256@1a2b3c4d"
+func lookupProjection(suffix string) (*Projection, error) {
+	_, id, ok := strings.Cut(suffix, "@")
+	if !ok {
+		return nil, fmt.Errorf("invalid projection suffix %q", suffix)
+	}
+	projectionsMu.RLock()
+	defer projectionsMu.RUnlock()
+	p, ok := projections[id]
+	if !ok {
+		return nil, fmt.Errorf("projection %s is not loaded", id)
+	}
+	return p, nil
+}
+
+// Project wraps embedder with projection, projection must be fitted on
+// vectors of the embedder method
+func Project(base Embedder, p *Projection) (Embedder, error) {
+	if base.Name() != p.Source {
+		return nil, fmt.Errorf("projection is fitted for '%s' method, not '%s'", p.Source, base.Name())
+	}
+	if dim := base.Dimension(); dim > 0 && dim != p.InputDim {
+		return nil, fmt.Errorf("projection input size %d does not match '%s' dimension %d", p.InputDim, base.Name(), dim)
+	}
+	return &ProjectedEmbedder{Base: base, Projection: p}, nil
+}
+
+// ProjectedEmbedder represents embedder which output is reduced by projection
+type ProjectedEmbedder struct {
+	Base       Embedder
+	Projection *Projection
+}
+
+// Name implements Embedder interface
+func (e *ProjectedEmbedder) Name() string { return e.Base.Name() + e.Projection.Suffix() }
+
+// Dimension implements Embedder interface
+func (e *ProjectedEmbedder) Dimension() int { return e.Projection.OutputDim }
+
+// Params implements Parameterized interface
+func (e *ProjectedEmbedder) Params() string {
+	if p, ok := e.Base.(Parameterized); ok {
+		return p.Params()
+	}
+	return ""
+}
+
+// BatchLimit implements BatchLimiter interface
+func (e *ProjectedEmbedder) BatchLimit(ctx context.Context) (int, error) {
+	return BatchLimit(ctx, e.Base)
+}
+
+// Embed implements Embedder interface
+func (e *ProjectedEmbedder) Embed(ctx context.Context, f *cbf.Frame) ([]float32, error) {
+	vec, err := e.Base.Embed(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return e.Projection.Apply(vec)
+}
+
+// EmbedBatch implements BatchEmbedder interface, frames are embedded in one
+// call if base embedder supports batches
+func (e *ProjectedEmbedder) EmbedBatch(ctx context.Context, frames []*cbf.Frame) ([][]float32, error) {
+	vecs, err := EmbedFrames(ctx, e.Base, frames)
+	if err != nil {
+		return nil, err
+	}
+	for i, vec := range vecs {
+		if vecs[i], err = e.Projection.Apply(vec); err != nil {
+			return nil, err
+		}
+	}
+	return vecs, nil
+}
+
+// NeighbourRecall measures how well projection preserves nearest neighbours:
+// for every vector it finds k nearest neighbours (cosine similarity) among
+// other vectors in original and projected space and returns average
+// fraction of original neighbours found in projected space
+func NeighbourRecall(orig, proj [][]float32, k int) float64 {
+	n := len(orig)
+	k = min(k, n-1)
+	if k <= 0 || len(proj) != n {
+		return 0
+	}
+	var total float64
+	for i := 0; i < n; i++ {
+		a := nearest(orig, i, k)
+		b := nearest(proj, i, k)
+		found := 0
+		for _, j := range b {
+			if slices.Contains(a, j) {
+				found++
+			}
+		}
+		total += float64(found) / float64(k)
+	}
+	return total / float64(n)
+}
+
+// nearest returns indexes of k vectors most similar to vector i
+func nearest(vecs [][]float32, i, k int) []int {
+	type hit struct {
+		idx   int
+		score float64
+	}
+	hits := make([]hit, 0, len(vecs)-1)
+	for j, v := range vecs {
+		if j == i {
+			continue
+		}
+		var dot, na, nb float64
+		for t, x := range vecs[i] {
+			dot += float64(x * v[t])
+			na += float64(x * x)
+			nb += float64(v[t] * v[t])
+		}
+		hits = append(hits, hit{j, dot / (math.Sqrt(na*nb) + 1e-12)})
+	}
+	sort.Slice(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	out := make([]int, k)
+	for t := range out {
+		out[t] = hits[t].idx
+	}
+	return out
+}
@@ -0,0 +1,256 @@
+package embed_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cbf2go/internal/embed"
+)
+
+// axisSample returns n vectors of dimension d spread along orthonormal axes
+// with given standard deviations plus small isotropic noise
+func axisSample(n, d int, axes [][]float64, stds []float64) [][]float32 {
+	rng := rand.New(rand.NewSource(1))
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		vecs[i] = make([]float32, d)
+		for j := range vecs[i] {
+			vecs[i][j] = float32(3 + 0.01*rng.NormFloat64())
+		}
+		for k, axis := range axes {
+			c := stds[k] * rng.NormFloat64()
+			for j, a := range axis {
+				vecs[i][j] += float32(c * a)
+			}
+		}
+	}
+	return vecs
+}
+
+// unitAxis returns unit vector of dimension d with given non-zero components
+func unitAxis(d int, comps map[int]float64) []float64 {
+	axis := make([]float64, d)
+	var norm float64
+	for j, c := range comps {
+		axis[j] = c
+		norm += c * c
+	}
+	for j := range axis {
+		axis[j] /= math.Sqrt(norm)
+	}
+	return axis
+}
+
+// checkComponents checks that PCA rows are parallel to expected axes
+func checkComponents(t *testing.T, p *embed.Projection, axes [][]float64) {
+	t.Helper()
+	for k, axis := range axes {
+		var dot float64
+		for j, a := range axis {
+			dot += a * float64(p.Matrix[k*p.InputDim+j])
+		}
+		if math.Abs(dot) < 0.99 {
+			t.Errorf("component %d is not parallel to expected axis, |cos| = %f", k, math.Abs(dot))
+		}
+	}
+	if p.Explained[0] <= p.Explained[1] {
+		t.Errorf("explained variance is not decreasing: %v", p.Explained)
+	}
+}
+
+func TestFitPCACovariance(t *testing.T) {
+	d := 4
+	axes := [][]float64{unitAxis(d, map[int]float64{0: 1, 1: 1}), unitAxis(d, map[int]float64{0: 1, 1: -1, 3: 1})}
+	vecs := axisSample(200, d, axes, []float64{10, 3})
+	p, err := embed.FitPCA("test", vecs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkComponents(t, p, axes)
+	// variances 100 and 9 dominate the noise
+	if math.Abs(p.Explained[0]-100.0/109) > 0.05 {
+		t.Errorf("unexpected explained variance %v", p.Explained)
+	}
+	for j, m := range p.Mean {
+		if math.Abs(float64(m)-3) > 2 {
+			t.Errorf("unexpected mean[%d] = %f", j, m)
+		}
+	}
+}
+
+func TestFitPCAGram(t *testing.T) {
+	// more dimensions than vectors uses Gram matrix of the sample
+	d := 50
+	axes := [][]float64{unitAxis(d, map[int]float64{2: 1, 7: 2, 40: -1}), unitAxis(d, map[int]float64{3: 1, 10: 1})}
+	vecs := axisSample(20, d, axes, []float64{10, 3})
+	p, err := embed.FitPCA("test", vecs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkComponents(t, p, axes)
+
+	// vectors are projected to output dimension
+	out, err := p.Apply(vecs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Errorf("expected 2 components, got %d", len(out))
+	}
+	if _, err := p.Apply(vecs[0][:10]); err == nil {
+		t.Error("expected error of input size mismatch")
+	}
+}
+
+func TestFitPCAErrors(t *testing.T) {
+	if _, err := embed.FitPCA("test", [][]float32{{1, 2}}, 1); err == nil {
+		t.Error("expected error of single vector")
+	}
+	if _, err := embed.FitPCA("test", [][]float32{{1, 2}, {1}}, 1); err == nil {
+		t.Error("expected error of size mismatch")
+	}
+	if _, err := embed.FitPCA("test", [][]float32{{1, 2}, {3, 4}, {5, 7}}, 3); err == nil {
+		t.Error("expected error of output dimension exceeding sample rank")
+	}
+}
+
+func TestProjectionRoundTrip(t *testing.T) {
+	d := 8
+	pca, err := embed.FitPCA("test", axisSample(30, d, [][]float64{unitAxis(d, map[int]float64{1: 1})}, []float64{5}), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := embed.NewRandomProjection("test", d, 3, 7)
+	dir := t.TempDir()
+	for _, p := range []*embed.Projection{pca, random} {
+		path := filepath.Join(dir, p.Type+".proj")
+		if err := embed.SaveProjection(path, p); err != nil {
+			t.Fatal(err)
+		}
+		out, err := embed.LoadProjection(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, p) || out.ID() != p.ID() {
+			t.Errorf("%s: loaded projection differs", p.Type)
+		}
+
+		// JSON files of earlier versions
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path = filepath.Join(dir, p.Type+".json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err = embed.LoadProjection(path); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, p) {
+			t.Errorf("%s: projection loaded from JSON differs", p.Type)
+		}
+	}
+
+	// matrix of random projection is regenerated from the seed
+	if info, err := os.Stat(filepath.Join(dir, "random.proj")); err != nil || info.Size() > 1024 {
+		t.Errorf("expected random projection without matrix, got %v, %v", info, err)
+	}
+	if other := embed.NewRandomProjection("test", d, 3, 8); other.ID() == random.ID() {
+		t.Error("projections of different seeds have the same ID")
+	}
+}
+
+func TestLoadProjectionErrors(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"type":   `{"type":"svd","input_dim":2,"output_dim":1}`,
+		"matrix": `{"type":"pca","input_dim":2,"output_dim":1,"matrix":[1]}`,
+		"syntax": `{"type":`,
+	}
+	for name, data := range cases {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := embed.LoadProjection(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	// corrupted sizes of binary header
+	for name, data := range map[string][]byte{
+		"header size": append([]byte("CBFPROJ1"), 0xff, 0xff, 0xff, 0x7f),
+		"truncated":   append([]byte("CBFPROJ1"), 0x10, 0, 0, 0, '{'),
+		"matrix size": append([]byte("CBFPROJ1\x3e\x00\x00\x00"), `{"type":"pca","input_dim":2,"output_dim":1,"matrix_size":1000}`...),
+	} {
+		path := filepath.Join(dir, "header.proj")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := embed.LoadProjection(path); err == nil {
+			t.Errorf("%s: expected error of corrupted binary projection", name)
+		}
+	}
+}
+
+func TestNewProjectedMethod(t *testing.T) {
+	base, err := embed.New(embed.MethodHistogram+":8", embed.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := embed.NewRandomProjection(base.Name(), base.Dimension(), 4, 11)
+	name := base.Name() + p.Suffix()
+	if _, err := embed.New(name, embed.Options{}); err == nil {
+		t.Error("expected error of projection which is not registered")
+	}
+	embed.RegisterProjection(p)
+	e, err := embed.New(name, embed.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name() != name || e.Dimension() != 4 {
+		t.Errorf("unexpected projected embedder %s of dimension %d", e.Name(), e.Dimension())
+	}
+	vec, err := e.Embed(context.Background(), featureFrame(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vec) != 4 {
+		t.Errorf("expected projected vector of size 4, got %d", len(vec))
+	}
+
+	// projection must be fitted on vectors of the base method
+	other := embed.NewRandomProjection(embed.MethodHistogram+":16", 64, 4, 11)
+	embed.RegisterProjection(other)
+	if _, err := embed.New(base.Name()+other.Suffix(), embed.Options{}); err == nil {
+		t.Error("expected error of projection of other method")
+	}
+}
+
+func TestNeighbourRecall(t *testing.T) {
+	d := 16
+	vecs := axisSample(40, d, [][]float64{unitAxis(d, map[int]float64{0: 1}), unitAxis(d, map[int]float64{5: 1})}, []float64{10, 5})
+	if r := embed.NeighbourRecall(vecs, vecs, 5); r != 1 {
+		t.Errorf("expected recall 1 of identical vectors, got %f", r)
+	}
+	p := embed.NewRandomProjection("test", d, 8, 3)
+	proj := make([][]float32, len(vecs))
+	for i, v := range vecs {
+		var err error
+		if proj[i], err = p.Apply(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r := embed.NeighbourRecall(vecs, proj, 5); r <= 0 || r > 1 {
+		t.Errorf("unexpected recall %f of random projection", r)
+	}
+	if r := embed.NeighbourRecall(vecs, proj[:10], 5); r != 0 {
+		t.Errorf("expected zero recall of mismatched samples, got %f", r)
+	}
+}
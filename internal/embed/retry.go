@@ -0,0 +1,351 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HTTPError represents non-200 response of embedding service
+type HTTPError struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Status     string `json:"status"`
+	Body       string `json:"body"` // beginning of response body
+	retryAfter time.Duration
+}
+
+// maximum size of response body kept in HTTPError
+var maxErrorBody = 1024
+
+// Error implements error interface
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s %s: server error: %s", e.Method, e.URL, e.Status)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Temporary returns true for server errors which may disappear on retry
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryPolicy represents retry policy of requests to embedding services
+type RetryPolicy struct {
+	MaxRetries     int           // number of retries after the first attempt
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // maximum delay between retries
+	Multiplier     float64       // backoff growth factor
+	Jitter         float64       // random fraction of backoff added or subtracted
+}
+
+// DefaultRetryPolicy returns default retry policy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// Backoff returns delay before given retry attempt (starting from 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(math.Max(p.Multiplier, 1), float64(attempt-1))
+	d = math.Min(d, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// ErrCircuitOpen is returned when circuit breaker is open and context
+// expires before service is probed again
+var ErrCircuitOpen = errors.New("embedding service circuit breaker is open")
+
+// states of circuit breaker
+const (
+	BreakerClosed   = "closed"    // requests pass
+	BreakerOpen     = "open"      // requests wait until cooldown expires
+	BreakerHalfOpen = "half-open" // single probe request passes, others wait for its outcome
+)
+
+// CircuitBreaker stops requests to embedding service after Threshold
+// consecutive failures for Cooldown period. Once cooldown expires circuit
+// is half-open: one probe request passes and closes circuit if it succeeds
+// or opens it again if it fails. Requests wait while circuit is not
+// closed, which pauses ingestion until service comes back.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// Logf logs state changes, nil disables logging
+	Logf func(format string, args ...any)
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	probe     chan struct{} // closed when probe of half-open circuit completes
+}
+
+// NewCircuitBreaker returns circuit breaker with given parameters
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, state: BreakerClosed}
+}
+
+// State returns current state of circuit breaker
+func (b *CircuitBreaker) State() string {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == "" {
+		return BreakerClosed
+	}
+	return b.state
+}
+
+// Wait blocks while circuit is open or its probe is in flight, caller
+// which finds expired cooldown becomes the probe
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		var timer *time.Timer
+		var expired <-chan time.Time
+		var probe chan struct{}
+		b.mu.Lock()
+		switch b.state {
+		case BreakerOpen:
+			wait := time.Until(b.openUntil)
+			if wait <= 0 {
+				b.state = BreakerHalfOpen
+				b.probe = make(chan struct{})
+				b.mu.Unlock()
+				return nil
+			}
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		case BreakerHalfOpen:
+			probe = b.probe
+		default:
+			b.mu.Unlock()
+			return nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return fmt.Errorf("%w: %w", ErrCircuitOpen, ctx.Err())
+		case <-expired:
+		case <-probe:
+		}
+	}
+}
+
+// setState changes state of circuit and releases requests waiting for
+// the probe, it must be called with locked mutex
+func (b *CircuitBreaker) setState(state string) {
+	if b.probe != nil {
+		close(b.probe)
+		b.probe = nil
+	}
+	b.state = state
+}
+
+// logf logs state change if logger is set
+func (b *CircuitBreaker) logf(format string, args ...any) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+	}
+}
+
+// Success resets failure counter and closes circuit
+func (b *CircuitBreaker) Success(service string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if b.state != BreakerClosed && b.state != "" {
+		b.setState(BreakerClosed)
+		b.logf("embedding service %s is back, resuming requests", service)
+	}
+}
+
+// Failure records failed request, circuit is opened when threshold is
+// reached or when probe of half-open circuit fails
+func (b *CircuitBreaker) Failure(service string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	switch b.state {
+	case BreakerOpen:
+		return
+	case BreakerHalfOpen:
+	default:
+		if b.Threshold <= 0 || b.failures < b.Threshold {
+			return
+		}
+	}
+	b.openUntil = time.Now().Add(b.Cooldown)
+	b.setState(BreakerOpen)
+	b.logf("embedding service %s failed %d times, pausing requests for %v", service, b.failures, b.Cooldown)
+}
+
+// Cancel releases probe of half-open circuit which ended without telling
+// if service is available, e.g. when its context was canceled, so the next
+// request probes the service
+func (b *CircuitBreaker) Cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.openUntil = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// default circuit breaker parameters of embedding clients
+var (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// requester sends requests to embedding service with retries and circuit
+// breaking
+type requester struct {
+	client  *http.Client
+	retry   RetryPolicy
+	breaker *CircuitBreaker
+}
+
+// do sends request and returns body of successful response, non-200
+// responses are returned as *HTTPError
+func (r requester) do(ctx context.Context, method, url string, body []byte, header map[string]string) ([]byte, error) {
+	client := r.client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := r.retry.Backoff(attempt)
+			var herr *HTTPError
+			if errors.As(err, &herr) && herr.retryAfter > delay {
+				delay = herr.retryAfter
+			}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+			case <-time.After(delay):
+			}
+		}
+		if werr := r.breaker.Wait(ctx); werr != nil {
+			return nil, werr
+		}
+		var data []byte
+		data, err = r.once(ctx, client, method, url, body, header)
+		if err == nil {
+			r.breaker.Success(url)
+			return data, nil
+		}
+		if !retryable(ctx, err) {
+			// client errors are answered by available service
+			var herr *HTTPError
+			if errors.As(err, &herr) {
+				r.breaker.Success(url)
+			} else {
+				r.breaker.Cancel()
+			}
+			return nil, err
+		}
+		r.breaker.Failure(url)
+		if attempt >= r.retry.MaxRetries {
+			return nil, err
+		}
+	}
+}
+
+// once sends single request
+func (r requester) once(ctx context.Context, client *http.Client, method, url string, body []byte, header map[string]string) ([]byte, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, rd)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		herr := &HTTPError{
+			Method:     method,
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(data[:min(len(data), maxErrorBody)])),
+		}
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			herr.retryAfter = time.Duration(sec) * time.Second
+		}
+		return nil, herr
+	}
+	return data, nil
+}
+
+// retryable returns true for transient errors: 5xx and 429 responses,
+// timeouts, refused and reset connections
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		return herr.Temporary()
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,100 @@
+package embed_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cbf2go/internal/embed"
+	"cbf2go/internal/embed/mock"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cfg := mock.DefaultConfig()
+	cfg.FailFirst = 2
+	_, url := newMock(t, cfg)
+	c := newClient(url)
+	c.Retry.MaxRetries = 0
+	c.Breaker = embed.NewCircuitBreaker(2, 50*time.Millisecond)
+	var mu sync.Mutex
+	var logs []string
+	c.Breaker.Logf = func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	ctx := context.Background()
+	pixels := make([]float32, 12)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.EmbedPixels(ctx, pixels, 3, 4); err == nil {
+			t.Fatalf("request %d: expected injected failure", i)
+		}
+	}
+	if state := c.Breaker.State(); state != embed.BreakerOpen {
+		t.Fatalf("expected open circuit after 2 failures, got %s", state)
+	}
+
+	// requests wait while circuit is open
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.EmbedPixels(tctx, pixels, 3, 4); !errors.Is(err, embed.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// probe after cooldown succeeds and closes circuit
+	if _, err := c.EmbedPixels(ctx, pixels, 3, 4); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if state := c.Breaker.State(); state != embed.BreakerClosed {
+		t.Errorf("expected closed circuit after successful probe, got %s", state)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 2 || !strings.Contains(logs[0], "pausing") || !strings.Contains(logs[1], "is back") {
+		t.Errorf("unexpected breaker logs %q", logs)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := embed.NewCircuitBreaker(1, 20*time.Millisecond)
+	ctx := context.Background()
+	b.Failure("test")
+	if b.State() != embed.BreakerOpen {
+		t.Fatalf("expected open circuit, got %s", b.State())
+	}
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != embed.BreakerHalfOpen {
+		t.Fatalf("expected half-open circuit after cooldown, got %s", b.State())
+	}
+
+	// other requests wait for the probe, failed probe opens circuit again
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(tctx); !errors.Is(err, embed.ErrCircuitOpen) {
+		t.Fatalf("expected request to wait for the probe, got %v", err)
+	}
+	b.Failure("test")
+	if b.State() != embed.BreakerOpen {
+		t.Fatalf("expected open circuit after failed probe, got %s", b.State())
+	}
+
+	// canceled probe lets the next request probe the service
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.Cancel()
+	if err := b.Wait(ctx); err != nil || b.State() != embed.BreakerHalfOpen {
+		t.Fatalf("expected new probe after canceled one, got %s, %v", b.State(), err)
+	}
+	b.Success("test")
+	if b.State() != embed.BreakerClosed {
+		t.Errorf("expected closed circuit, got %s", b.State())
+	}
+}
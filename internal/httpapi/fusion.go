@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fusion methods of hybrid search
+const (
+	FusionRRF      = "rrf"      // reciprocal rank fusion
+	FusionWeighted = "weighted" // weighted sum of min-max normalized scores
+)
+
+// DefaultRRFK is rank constant of reciprocal rank fusion
+var DefaultRRFK = 60
+
+// RankedList represents hits of single query of hybrid search ordered by
+// decreasing score
+type RankedList struct {
+	Name   string
+	Weight float64
+	Hits   []map[string]any
+}
+
+// Fuse combines ranked lists into a single list of at most limit hits.
+// Hits are matched by point ID, every fused hit contains payload, fused
+// "_score", per-method scores in "_scores" and 1-based ranks in "_ranks".
+func Fuse(lists []RankedList, fusion string, k, limit int) ([]map[string]any, error) {
+	if fusion == "" {
+		fusion = FusionRRF
+	}
+	if fusion != FusionRRF && fusion != FusionWeighted {
+		return nil, fmt.Errorf("unsupported fusion method '%s', use %s or %s", fusion, FusionRRF, FusionWeighted)
+	}
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+
+	fused := make(map[string]map[string]any)
+	scores := make(map[string]float64)
+	var ids []string
+	for _, l := range lists {
+		lo, hi := scoreRange(l.Hits)
+		for rank, hit := range l.Hits {
+			id := fmt.Sprint(hit["_id"])
+			rec, ok := fused[id]
+			if !ok {
+				rec = make(map[string]any, len(hit)+2)
+				for key, v := range hit {
+					rec[key] = v
+				}
+				rec["_scores"] = map[string]any{}
+				rec["_ranks"] = map[string]int{}
+				fused[id] = rec
+				ids = append(ids, id)
+			}
+			score := hitScore(hit)
+			rec["_scores"].(map[string]any)[l.Name] = hit["_score"]
+			rec["_ranks"].(map[string]int)[l.Name] = rank + 1
+			if fusion == FusionRRF {
+				scores[id] += l.Weight / float64(k+rank+1)
+			} else {
+				norm := 1.0
+				if hi > lo {
+					norm = (score - lo) / (hi - lo)
+				}
+				scores[id] += l.Weight * norm
+			}
+		}
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	out := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		rec := fused[id]
+		rec["_score"] = scores[id]
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// hitScore returns search score of a hit
+func hitScore(hit map[string]any) float64 {
+	switch v := hit["_score"].(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// scoreRange returns minimum and maximum score of hits
+func scoreRange(hits []map[string]any) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, hit := range hits {
+		s := hitScore(hit)
+		lo = math.Min(lo, s)
+		hi = math.Max(hi, s)
+	}
+	return lo, hi
+}
+
+// ParseWeights parses weights of hybrid search queries in "name:weight,..."
+// form, e.g. "pixel:1,clip_text:0.5"
+func ParseWeights(s string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	if s == "" {
+		return weights, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight '%s', expected name:weight", item)
+		}
+		w, err := strconv.ParseFloat(val, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight '%s' of %s", val, name)
+		}
+		weights[name] = w
+	}
+	return weights, nil
+}
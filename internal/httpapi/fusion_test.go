@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// hits returns ranked hits with given IDs and scores
+func hits(ids []string, scores []float64) []map[string]any {
+	out := make([]map[string]any, len(ids))
+	for i, id := range ids {
+		out[i] = map[string]any{"_id": id, "_score": scores[i], "path": "/data/" + id}
+	}
+	return out
+}
+
+// fusedIDs returns IDs of fused hits
+func fusedIDs(fused []map[string]any) []string {
+	ids := make([]string, len(fused))
+	for i, hit := range fused {
+		ids[i] = hit["_id"].(string)
+	}
+	return ids
+}
+
+func TestFuseRRF(t *testing.T) {
+	lists := []RankedList{
+		{Name: "pixel", Weight: 1, Hits: hits([]string{"a", "b", "c"}, []float64{0.9, 0.8, 0.7})},
+		{Name: "clip_text", Weight: 1, Hits: hits([]string{"b", "d"}, []float64{0.3, 0.2})},
+	}
+	fused, err := Fuse(lists, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := fusedIDs(fused); !reflect.DeepEqual(ids, []string{"b", "a", "d", "c"}) {
+		t.Fatalf("unexpected order %v", ids)
+	}
+	b := fused[0]
+	k := float64(DefaultRRFK)
+	if score := b["_score"].(float64); math.Abs(score-(1/(k+2)+1/(k+1))) > 1e-12 {
+		t.Errorf("unexpected RRF score %v", score)
+	}
+	if ranks := b["_ranks"].(map[string]int); ranks["pixel"] != 2 || ranks["clip_text"] != 1 {
+		t.Errorf("unexpected ranks %v", ranks)
+	}
+	if scores := b["_scores"].(map[string]any); scores["pixel"] != 0.8 || scores["clip_text"] != 0.3 {
+		t.Errorf("unexpected per-method scores %v", scores)
+	}
+	if b["path"] != "/data/b" {
+		t.Errorf("payload is not kept: %v", b)
+	}
+}
+
+func TestFuseWeighted(t *testing.T) {
+	lists := []RankedList{
+		{Name: "pixel", Weight: 1, Hits: hits([]string{"a", "b", "c"}, []float64{0.9, 0.5, 0.1})},
+		{Name: "clip_image", Weight: 3, Hits: hits([]string{"c", "a"}, []float64{0.4, 0.2})},
+	}
+	fused, err := Fuse(lists, FusionWeighted, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c: 0 + 3*1, a: 1 + 3*0, b: 0.5
+	if ids := fusedIDs(fused); !reflect.DeepEqual(ids, []string{"c", "a"}) {
+		t.Fatalf("unexpected order %v", ids)
+	}
+	if score := fused[0]["_score"].(float64); math.Abs(score-3) > 1e-12 {
+		t.Errorf("unexpected weighted score %v", score)
+	}
+}
+
+func TestFuseTies(t *testing.T) {
+	lists := []RankedList{
+		{Name: "pixel", Weight: 1, Hits: hits([]string{"b"}, []float64{0.5})},
+		{Name: "clip_text", Weight: 1, Hits: hits([]string{"a"}, []float64{0.5})},
+	}
+	fused, err := Fuse(lists, FusionRRF, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := fusedIDs(fused); !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("ties are not ordered by ID: %v", ids)
+	}
+}
+
+func TestFuseUnsupported(t *testing.T) {
+	if _, err := Fuse(nil, "max", 0, 0); err == nil {
+		t.Error("expected error of unsupported fusion method")
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	w, err := ParseWeights(" pixel:1, clip_text:0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w, map[string]float64{"pixel": 1, "clip_text": 0.5}) {
+		t.Errorf("unexpected weights %v", w)
+	}
+	if w, err := ParseWeights(""); err != nil || len(w) != 0 {
+		t.Errorf("expected no weights, got %v, %v", w, err)
+	}
+	for _, s := range []string{"pixel", "pixel:x", "pixel:-1"} {
+		if _, err := ParseWeights(s); err == nil {
+			t.Errorf("expected error of %q", s)
+		}
+	}
+}
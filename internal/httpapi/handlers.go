@@ -1,8 +1,14 @@
 package httpapi
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"log"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 
@@ -18,6 +24,17 @@ import (
 type Server struct {
 	Qdrant   *qdrant.Client
 	EmbedURL string
+	Cache    *embed.Cache // embedding cache, nil disables caching
+	// mask applied to queried frames, frames must have the same dimensions
+	Mask                  cbf.Mask
+	MaskWidth, MaskHeight int
+	// CLIP service and collection of CLIP embeddings used by text and
+	// image queries, nil Clip disables them
+	Clip           *embed.CLIPClient
+	ClipCollection string
+
+	embedMu   sync.Mutex
+	embedders map[string]embed.Embedder // query embedders by method and size
 }
 
 // default size of embedded vector and number of matches to seek
@@ -26,6 +43,10 @@ var defaultLimit = 10
 
 func (s *Server) Register(r *gin.Engine) {
 	r.GET("/search_cbf_path", s.searchFile)
+	r.GET("/stats_cbf_path", s.statsFile)
+	r.GET("/search_text", s.hybridSearch)
+	r.POST("/hybridsearch", s.hybridSearch)
+	// misspelled route kept for existing clients
 	r.POST("/hybdridsearch", s.hybridSearch)
 }
 
@@ -41,52 +62,134 @@ func (s *Server) searchFile(c *gin.Context) {
 	if val, err := strconv.Atoi(c.Query("limit")); err == nil {
 		limit = val
 	}
-	s.searchPath(c, collection, path, method, size, limit)
+	filter, err := metadataFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	background, err := cbf.ParseBackgroundMethod(c.Query("background"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	s.searchPath(c, collection, path, method, background, size, limit, filter)
+}
+
+// metadataFilter builds qdrant filter from min_resolution and
+// max_resolution (Angstrom), detector and ice_rings parameters, it returns
+// nil if none of them is provided
+func metadataFilter(c *gin.Context) (map[string]any, error) {
+	var must []map[string]any
+	rng := map[string]any{}
+	for name, op := range map[string]string{"min_resolution": "gte", "max_resolution": "lte"} {
+		val := param(c, name)
+		if val == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", name, val, err)
+		}
+		rng[op] = v
+	}
+	if len(rng) > 0 {
+		must = append(must, map[string]any{"key": "resolution", "range": rng})
+	}
+	if val := param(c, "detector"); val != "" {
+		must = append(must, map[string]any{"key": "detector", "match": map[string]any{"value": val}})
+	}
+	if val := param(c, "ice_rings"); val != "" {
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ice_rings value %q: %w", val, err)
+		}
+		must = append(must, map[string]any{"key": "ice_rings", "match": map[string]any{"value": v}})
+	}
+	if len(must) == 0 {
+		return nil, nil
+	}
+	return map[string]any{"must": must}, nil
 }
 
-func (s *Server) searchPath(c *gin.Context, collection, path, method string, size, limit int) {
-	// use verbose=0 for ReadCBF function call
-	pixels, w, h, err := cbf.ReadCBF(path, 0)
+// param returns value of form or query parameter
+func param(c *gin.Context, name string) string {
+	if val := c.PostForm(name); val != "" {
+		return val
+	}
+	return c.Query(name)
+}
+
+func (s *Server) statsFile(c *gin.Context) {
+	path := c.Query("path")
+	frame, err := s.readFrame(path)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
-	//log.Printf("qdrant search pixes=%v, w=%v h=%v", len(pixels), w, h)
-
-	verbose := 0 // no verbose information
-	var vec []float32
-	if method == "resnet" {
-		ec := embed.NewEmbedClient(s.EmbedURL)
+	mask := frame.DefaultMask()
+	spots := cbf.FindSpots(frame, mask, cbf.DefaultSpotParams())
+	rec := gin.H{
+		"path":    path,
+		"stats":   cbf.ComputeStats(frame, mask, cbf.DefaultHistogramBins),
+		"n_spots": len(spots),
+	}
+	if res, err := cbf.EstimateResolution(frame, spots, cbf.DefaultResolutionParams()); err == nil {
+		rec["resolution"] = res
+	}
+	c.JSON(200, rec)
+}
 
-		var floatPixels []float32
-		for _, p := range pixels {
-			floatPixels = append(floatPixels, float32(p))
+// readFrame reads CBF file and applies server mask to it
+func (s *Server) readFrame(path string) (*cbf.Frame, error) {
+	frame, err := cbf.ReadFrame(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if s.Mask != nil {
+		if frame.Width != s.MaskWidth || frame.Height != s.MaskHeight {
+			return nil, fmt.Errorf("mask size %dx%d does not match frame size %dx%d", s.MaskWidth, s.MaskHeight, frame.Width, frame.Height)
+		}
+		if err := frame.ApplyMask(s.Mask, cbf.MaskedValue); err != nil {
+			return nil, err
 		}
+	}
+	return frame, nil
+}
 
-		vec, err = ec.EmbedPixels(floatPixels, h, w)
+func (s *Server) searchPath(c *gin.Context, collection, path, method string, background cbf.BackgroundMethod, size, limit int, filter map[string]any) {
+	// use verbose=0 for ReadFrame function call
+	frame, err := s.readFrame(path)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if background != cbf.BackgroundNone {
+		frame, err = cbf.SubtractBackground(frame, nil, background, cbf.DefaultBackgroundParams())
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-	} else {
-		vec = embed.ImageToEmbedding(pixels, w, h, size, verbose)
+	}
+	client, err := s.collectionClient(collection)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	embedder, code, err := s.queryEmbedder(c.Request.Context(), client, method, background, size)
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	vec, err := embedder.Embed(c.Request.Context(), frame)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 	var hits []map[string]any
-	if collection != "" {
-		// we need to use new client with that collection
-		client, e := qdrant.NewQdrantClient(
-			s.Qdrant.URL,
-			collection,
-			s.Qdrant.FileExtension,
-			s.Qdrant.Verbose,
-		)
-		if e != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-		hits, err = client.Search(vec, limit)
+	if filter != nil {
+		hits, err = client.SearchWithFilter(vec, limit, filter)
 	} else {
-		hits, err = s.Qdrant.Search(vec, limit)
+		hits, err = client.Search(vec, limit)
 	}
 	// log.Printf("qdrant search %+v, error=%v", hits, err)
 	if err != nil {
@@ -97,24 +200,241 @@ func (s *Server) searchPath(c *gin.Context, collection, path, method string, siz
 	c.JSON(200, gin.H{"hits": hits})
 }
 
+// collectionClient returns qdrant client of given collection, empty
+// collection refers to server collection
+func (s *Server) collectionClient(collection string) (*qdrant.Client, error) {
+	if collection == "" {
+		return s.Qdrant, nil
+	}
+	// we need to use new client with that collection
+	return qdrant.NewQdrantClient(
+		s.Qdrant.URL,
+		collection,
+		s.Qdrant.FileExtension,
+		s.Qdrant.Verbose,
+	)
+}
+
+// queryEmbedder returns cached embedder of queries to collection of given
+// client along with HTTP status code of error
+func (s *Server) queryEmbedder(ctx context.Context, client *qdrant.Client, method string, background cbf.BackgroundMethod, size int) (embed.Embedder, int, error) {
+	// query must be embedded with the same method as collection points
+	cmethod, err := client.CollectionMethod(ctx)
+	if err != nil {
+		return nil, 500, err
+	}
+	if method == "" {
+		method = cmethod
+	}
+	if method == "" {
+		method = embed.DefaultMethod
+	}
+	embedder, err := s.embedder(method, size)
+	if err != nil {
+		return nil, 400, err
+	}
+	if cmethod != "" && embedder.Name() != cmethod {
+		return nil, 400, fmt.Errorf("collection %s is embedded with '%s' method, not '%s'", client.Collection, cmethod, embedder.Name())
+	}
+	if (s.Mask != nil || background != cbf.BackgroundNone) && !embed.SupportsMasks(embedder.Name()) {
+		return nil, 400, fmt.Errorf("method '%s' does not support masks and background subtraction", embedder.Name())
+	}
+	return embed.WithCache(embedder, s.Cache), 200, nil
+}
+
+// embedder returns embedder of given method and vector size, embedders are
+// created once and shared by requests, so retry state of their clients and
+// negotiated capabilities are kept between queries
+func (s *Server) embedder(method string, size int) (embed.Embedder, error) {
+	key := fmt.Sprintf("%s/%d", method, size)
+	s.embedMu.Lock()
+	defer s.embedMu.Unlock()
+	if e, ok := s.embedders[key]; ok {
+		return e, nil
+	}
+	e, err := embed.New(method, embed.Options{URL: s.EmbedURL, Size: size, Logf: log.Printf})
+	if err != nil {
+		return nil, err
+	}
+	if s.embedders == nil {
+		s.embedders = make(map[string]embed.Embedder)
+	}
+	s.embedders[key] = e
+	return e, nil
+}
+
+// hybridSearch runs several queries in parallel and fuses their hits:
+// pixel embedding and CLIP embedding of a frame given by server path or
+// uploaded CBF file, CLIP embedding of uploaded image and of text query,
+// e.g. "ice rings". All queries share metadata filter. Fusion method is
+// set by fusion (rrf or weighted), rrf_k and weights parameters, e.g.
+// weights=pixel:1,clip_text:2. If collection parameter is given CLIP
+// queries use its <collection>_clip collection like cbf_ingest does.
 func (s *Server) hybridSearch(c *gin.Context) {
-	text := c.PostForm("text")
-	file, _ := c.FormFile("image")
+	ctx := c.Request.Context()
+	text := param(c, "text")
+	path := param(c, "path")
+	size := defaultSize
+	if val, err := strconv.Atoi(param(c, "size")); err == nil {
+		size = val
+	}
+	limit := defaultLimit
+	if val, err := strconv.Atoi(param(c, "limit")); err == nil {
+		limit = val
+	}
+	k := DefaultRRFK
+	if val, err := strconv.Atoi(param(c, "rrf_k")); err == nil {
+		k = val
+	}
+	fusion := param(c, "fusion")
+	weights, err := ParseWeights(param(c, "weights"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := metadataFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	background, err := cbf.ParseBackgroundMethod(param(c, "background"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
+	// query frame is given either by server path or uploaded CBF file,
+	// other uploaded images are used for CLIP query only
+	var frame *cbf.Frame
 	var imgBytes []byte
-	if file != nil {
-		f, _ := file.Open()
-		imgBytes, _ = io.ReadAll(f)
+	if path != "" {
+		if frame, err = s.readFrame(path); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if file, err := c.FormFile("image"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		imgBytes, err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.HasSuffix(strings.ToLower(file.Filename), "."+s.Qdrant.FileExtension) {
+			if frame, err = s.uploadedFrame(imgBytes); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			imgBytes = nil
+		}
+	}
+	if frame != nil && background != cbf.BackgroundNone {
+		if frame, err = cbf.SubtractBackground(frame, nil, background, cbf.DefaultBackgroundParams()); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if s.Clip == nil && (text != "" || imgBytes != nil) {
+		c.JSON(503, gin.H{"error": "CLIP service is not configured"})
+		return
 	}
 
-	var qdrant *qdrant.Client
-	var clip *embed.CLIPClient
+	weight := func(name string) float64 {
+		if w, ok := weights[name]; ok {
+			return w
+		}
+		return 1
+	}
+	collection := param(c, "collection")
+	var queries []VectorQuery
+	if frame != nil {
+		client, err := s.collectionClient(collection)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		embedder, code, err := s.queryEmbedder(ctx, client, param(c, "method"), background, size)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		queries = append(queries, VectorQuery{
+			Name:   QueryPixel,
+			Client: client,
+			Weight: weight(QueryPixel),
+			Embed:  func(ctx context.Context) ([]float32, error) { return embedder.Embed(ctx, frame) },
+		})
+	}
+	if s.Clip != nil {
+		client := s.Qdrant.WithCollection(s.clipCollection(collection))
+		switch {
+		case frame != nil:
+			// frame is rendered the same way as at ingest time
+			embedder := embed.WithCache(&embed.CLIPEmbedder{Client: s.Clip}, s.Cache)
+			queries = append(queries, VectorQuery{
+				Name:   QueryCLIPImage,
+				Client: client,
+				Weight: weight(QueryCLIPImage),
+				Embed:  func(ctx context.Context) ([]float32, error) { return embedder.Embed(ctx, frame) },
+			})
+		case imgBytes != nil:
+			queries = append(queries, VectorQuery{
+				Name:   QueryCLIPImage,
+				Client: client,
+				Weight: weight(QueryCLIPImage),
+				Embed:  func(ctx context.Context) ([]float32, error) { return s.Clip.EmbedImage(ctx, imgBytes) },
+			})
+		}
+		if text != "" {
+			queries = append(queries, VectorQuery{
+				Name:   QueryCLIPText,
+				Client: client,
+				Weight: weight(QueryCLIPText),
+				Embed:  func(ctx context.Context) ([]float32, error) { return s.Clip.EmbedText(ctx, text) },
+			})
+		}
+	}
 
-	hits, err := HybridSearch(qdrant, clip, imgBytes, text)
+	hits, err := HybridSearch(ctx, queries, filter, fusion, k, limit)
 	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	methods := make([]string, len(queries))
+	for i, q := range queries {
+		methods[i] = q.Name
+	}
 
-	c.JSON(200, gin.H{"hits": hits})
+	c.JSON(200, gin.H{"hits": hits, "methods": methods})
+}
+
+// clipCollection returns CLIP collection of given pixel collection, empty
+// collection refers to server CLIP collection
+func (s *Server) clipCollection(collection string) string {
+	if collection == "" {
+		return s.ClipCollection
+	}
+	return collection + "_clip"
+}
+
+// uploadedFrame reads uploaded CBF file and applies server mask to it
+func (s *Server) uploadedFrame(data []byte) (*cbf.Frame, error) {
+	tmp, err := os.CreateTemp("", "cbf2go-*.cbf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return s.readFrame(tmp.Name())
 }
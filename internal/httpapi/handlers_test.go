@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"path/filepath"
+	"testing"
+
+	"cbf2go/internal/cbf"
+	"cbf2go/internal/embed"
+)
+
+func TestServerEmbedder(t *testing.T) {
+	s := &Server{}
+	a, err := s.embedder(embed.DefaultMethod, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.embedder(embed.DefaultMethod, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("expected embedder to be reused by queries of the same method and size")
+	}
+	c, err := s.embedder(embed.DefaultMethod, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == a {
+		t.Error("expected new embedder of other size")
+	}
+	if _, err := s.embedder("unknown", 64); err == nil {
+		t.Error("expected error of unknown method")
+	}
+	if len(s.embedders) != 2 {
+		t.Errorf("expected 2 cached embedders, got %d", len(s.embedders))
+	}
+}
+
+func TestServerClipCollection(t *testing.T) {
+	s := &Server{ClipCollection: "frames_clip"}
+	if col := s.clipCollection(""); col != "frames_clip" {
+		t.Errorf("expected server CLIP collection, got %q", col)
+	}
+	if col := s.clipCollection("sweeps"); col != "sweeps_clip" {
+		t.Errorf("expected CLIP collection of requested collection, got %q", col)
+	}
+}
+
+func TestServerReadFrameMask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frame.cbf")
+	frame := &cbf.Frame{Pixels: []int32{1, 2, 3, 4, 5, 6}, Width: 3, Height: 2}
+	if err := cbf.WriteCBF(path, frame); err != nil {
+		t.Fatal(err)
+	}
+	mask := cbf.Mask{false, true, false, false, false, true}
+
+	// mask of the same length but other dimensions is rejected
+	s := &Server{Mask: mask, MaskWidth: 2, MaskHeight: 3}
+	if _, err := s.readFrame(path); err == nil {
+		t.Error("expected error of mask size mismatch")
+	}
+	s.MaskWidth, s.MaskHeight = 3, 2
+	out, err := s.readFrame(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Pixels[1] != cbf.MaskedValue || out.Pixels[5] != cbf.MaskedValue || out.Pixels[0] != 1 {
+		t.Errorf("unexpected masked frame %v", out.Pixels)
+	}
+}
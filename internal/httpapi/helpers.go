@@ -1,32 +1,78 @@
 package httpapi
 
 import (
-	"cbf2go/internal/embed"
 	"cbf2go/internal/qdrant"
+	"context"
 	"fmt"
+	"sync"
 )
 
+// names of hybrid search queries
+const (
+	QueryPixel     = "pixel"      // pixel embedding of a frame
+	QueryCLIPImage = "clip_image" // CLIP embedding of a frame or image
+	QueryCLIPText  = "clip_text"  // CLIP embedding of text
+)
+
+// number of candidates fetched by every query per requested hit, fused list
+// is more accurate when queries return more than limit hits
+var candidateFactor = 5
+
+// VectorQuery represents single query of hybrid search, Embed returns query
+// vector which is searched in collection of Client
+type VectorQuery struct {
+	Name   string
+	Client *qdrant.Client
+	Weight float64
+	Embed  func(ctx context.Context) ([]float32, error)
+}
+
+// HybridSearch runs queries in parallel with the same metadata filter and
+// fuses their hits, see Fuse
 func HybridSearch(
-	qdrant *qdrant.Client,
-	clip *embed.CLIPClient,
-	imageBytes []byte,
-	text string,
+	ctx context.Context,
+	queries []VectorQuery,
+	filter map[string]any,
+	fusion string,
+	k int,
+	limit int,
 ) ([]map[string]any, error) {
 
-	var vec []float32
-	var err error
-
-	switch {
-	case imageBytes != nil:
-		vec, err = clip.EmbedImage(imageBytes)
-	case text != "":
-		vec, err = clip.EmbedText(text)
-	default:
+	if len(queries) == 0 {
 		return nil, fmt.Errorf("no query provided")
 	}
-	if err != nil {
-		return nil, err
-	}
+	candidates := limit * candidateFactor
 
-	return qdrant.Search(vec, 10)
+	lists := make([]RankedList, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vec, err := q.Embed(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s query: %w", q.Name, err)
+				return
+			}
+			var hits []map[string]any
+			if filter != nil {
+				hits, err = q.Client.SearchWithFilter(vec, candidates, filter)
+			} else {
+				hits, err = q.Client.Search(vec, candidates)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s query: %w", q.Name, err)
+				return
+			}
+			lists[i] = RankedList{Name: q.Name, Weight: q.Weight, Hits: hits}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Fuse(lists, fusion, k, limit)
 }
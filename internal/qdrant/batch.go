@@ -3,16 +3,15 @@ package qdrant
 import (
 	"cbf2go/internal/cbf"
 	"cbf2go/internal/embed"
+	"cbf2go/internal/sweep"
+	"cbf2go/internal/walk"
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	qdrant "github.com/qdrant/go-client/qdrant"
 )
 
@@ -20,33 +19,13 @@ import (
 // - If it's a file, returns a slice with that single file.
 // - If it's a directory, returns a slice of all regular files in that directory (non-recursive).
 func GetFilesFromPath(path string) ([]string, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat path %q: %w", path, err)
-	}
-
-	if !info.IsDir() {
-		// It's a single file
-		return []string{path}, nil
-	}
-
-	// It's a directory: list all files (non-recursive)
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory %q: %w", path, err)
-	}
-
-	var files []string
-	for _, entry := range entries {
-		if entry.Type().IsRegular() {
-			files = append(files, filepath.Join(path, entry.Name()))
-		}
-	}
-
-	return files, nil
+	return walk.Files(path, walk.Options{Hidden: true, Symlinks: walk.SymlinkSkip})
 }
 
 func (c *Client) ensureCollection(ctx context.Context, vectorSize int) error {
+	// workers may ingest first frames concurrently, collection is created once
+	c.collMu.Lock()
+	defer c.collMu.Unlock()
 	if c.CollectionCreated {
 		if c.Verbose > 0 {
 			fmt.Printf("Collection %s already exist", c.Collection)
@@ -56,6 +35,7 @@ func (c *Client) ensureCollection(ctx context.Context, vectorSize int) error {
 	_, err := c.QdrantClient.GetCollectionInfo(ctx, c.Collection)
 	if err == nil {
 		// Collection exists
+		c.CollectionCreated = true
 		return nil
 	}
 
@@ -74,235 +54,571 @@ func (c *Client) ensureCollection(ctx context.Context, vectorSize int) error {
 	return err
 }
 
-func (c *Client) IngestViaEmbedClient(ctx context.Context, path string, vectorSize int, eurl string) error {
+// collectionExists reports if collection exists, existing collection is
+// marked as created
+func (c *Client) collectionExists(ctx context.Context) (bool, error) {
+	c.collMu.Lock()
+	defer c.collMu.Unlock()
+	if c.CollectionCreated {
+		return true, nil
+	}
+	exists, err := c.QdrantClient.CollectionExists(ctx, c.Collection)
+	if err != nil {
+		return false, err
+	}
+	c.CollectionCreated = exists
+	return exists, nil
+}
+
+// checkEmbedder checks that client embedder is set and can embed frames
+// with client mask and background
+func (c *Client) checkEmbedder() error {
+	if c.Embedder == nil {
+		return errors.New("embedder is not set")
+	}
+	if (c.Mask != nil || (c.Background != "" && c.Background != cbf.BackgroundNone)) && !embed.SupportsMasks(c.Embedder.Name()) {
+		return fmt.Errorf("method '%s' does not support masks and background subtraction", c.Embedder.Name())
+	}
+	return nil
+}
+
+// IngestOne ingests single CBF file into the collection using client embedder
+func (c *Client) IngestOne(ctx context.Context, path string) error {
+	if err := c.checkEmbedder(); err != nil {
+		return err
+	}
 
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return ingestError(ErrorRead, err)
 	}
 
-	filename := filepath.Base(absPath)
+	frame, err := cbf.ReadFrame(path, c.Verbose)
+	if err != nil {
+		return ingestError(ErrorRead, err)
+	}
+	if c.Mask != nil {
+		if frame.Width != c.MaskWidth || frame.Height != c.MaskHeight {
+			err := fmt.Errorf("mask size %dx%d does not match frame size %dx%d", c.MaskWidth, c.MaskHeight, frame.Width, frame.Height)
+			return ingestError(ErrorPreprocess, err)
+		}
+		if err := frame.ApplyMask(c.Mask, cbf.MaskedValue); err != nil {
+			return ingestError(ErrorPreprocess, err)
+		}
+	}
 
-	exists, err := c.imageAlreadyInCollection(ctx, filename)
+	fp := newFingerprint(frame)
+	id, err := c.pointID(absPath, fp, c.Embedder.Name())
 	if err != nil {
-		return err
+		return ingestError(ErrorRead, err)
+	}
+	exists, err := c.imageAlreadyInCollection(ctx, id, fp)
+	if err != nil {
+		return ingestError(ErrorQdrant, err)
 	}
 	if exists {
-		fmt.Println("skipping (already ingested):", filename)
+		fmt.Println("skipping (already ingested):", absPath)
+		c.tracker.skipped(absPath, fp.SHA256)
 		return nil
 	}
+	eframe, err := c.embeddingFrame(frame)
+	if err != nil {
+		return ingestError(ErrorPreprocess, err)
+	}
 
-	pixels, w, h, err := cbf.ReadCBF(path, c.Verbose)
+	vec, err := c.embedFrame(ctx, eframe)
 	if err != nil {
-		return err
+		return ingestError(ErrorEmbed, err)
+	}
+	if c.Verbose > 0 {
+		fmt.Printf("%s embedding vector size: %d, width=%d height=%d\n", c.Embedder.Name(), len(vec), frame.Width, frame.Height)
+	}
+
+	// Ensure collection exists before upsert
+	if err := c.ensureCollection(ctx, len(vec)); err != nil {
+		fmt.Printf("failed to create collection: %v\n", err)
+		return ingestError(ErrorQdrant, err)
 	}
 
-	if c.EmbedClient == nil {
-		c.EmbedClient = embed.NewEmbedClient(eurl)
+	payload := c.framePayload(absPath, frame, fp, c.Embedder.Name())
+	npoints := 1
+	if c.Clip != nil {
+		npoints++
 	}
+	c.tracker.expect(absPath, fp.SHA256, id, npoints)
+	if err := c.upsertPoint(ctx, absPath, id, vec, payload); err != nil {
+		return ingestError(ErrorUpsert, err)
+	}
+	if c.Clip != nil {
+		return c.upsertClip(ctx, absPath, id, eframe, payload)
+	}
+	return nil
+}
 
-	var floatPixels []float32
-	for _, p := range pixels {
-		floatPixels = append(floatPixels, float32(p))
+// embedFrame embeds frame via embedding batcher of running batch ingestion
+// or directly
+func (c *Client) embedFrame(ctx context.Context, frame *cbf.Frame) ([]float32, error) {
+	if c.batcher != nil {
+		return c.batcher.Embed(ctx, frame)
 	}
+	return c.Embedder.Embed(ctx, frame)
+}
 
-	vec, err := c.EmbedClient.EmbedPixels(floatPixels, h, w)
+// upsertPoint queues point to upsert pipeline of running batch ingestion or
+// upserts it directly
+func (c *Client) upsertPoint(ctx context.Context, file, id string, vec []float32, payload map[string]any) error {
+	if c.upserter != nil {
+		return c.upserter.Add(ctx, file, id, vec, payload)
+	}
+	err := c.Upsert(ctx, id, vec, payload)
+	c.tracker.done(file, err)
+	return err
+}
+
+// upsertClip adds CLIP embedding of the frame to CLIP collection using point
+// ID of the main collection, so hits of both collections refer to the same frame
+func (c *Client) upsertClip(ctx context.Context, file, id string, frame *cbf.Frame, payload map[string]any) error {
+	vec, err := c.Clip.Embedder.Embed(ctx, frame)
 	if err != nil {
-		return err
+		return ingestError(ErrorEmbed, fmt.Errorf("clip embedding: %w", err))
+	}
+	if err := c.Clip.ensureCollection(ctx, len(vec)); err != nil {
+		return ingestError(ErrorQdrant, err)
+	}
+	clipPayload := make(map[string]any, len(payload))
+	for k, v := range payload {
+		clipPayload[k] = v
 	}
+	clipPayload["method"] = c.Clip.Embedder.Name()
+	if err := c.Clip.upsertPoint(ctx, file, id, vec, clipPayload); err != nil {
+		return ingestError(ErrorUpsert, err)
+	}
+	return nil
+}
 
-	// Ensure collection exists before upsert
-	if err := c.ensureCollection(ctx, len(vec)); err != nil {
-		fmt.Printf("failed to create collection: %v\n", err)
-		return err
+// embeddingFrame returns frame used to compute embedding, i.e. frame with
+// subtracted background if background method is set
+func (c *Client) embeddingFrame(frame *cbf.Frame) (*cbf.Frame, error) {
+	if c.Background == "" || c.Background == cbf.BackgroundNone {
+		return frame, nil
+	}
+	return cbf.SubtractBackground(frame, nil, c.Background, cbf.DefaultBackgroundParams())
+}
+
+// number of perceptual hash bands stored in payload, frames within
+// cbf.NearDuplicateDistance share at least one band
+const phashBands = cbf.NearDuplicateDistance + 1
+
+// maximum number of near-duplicate candidates verified per frame
+var nearDuplicateCandidates = uint32(32)
+
+// fingerprint represents content hashes of a frame used for deduplication
+type fingerprint struct {
+	SHA256 string // hash of CBF binary section
+	PHash  string // perceptual hash of downsampled image
+	hash   uint64
+}
+
+// newFingerprint computes content hashes of a frame
+func newFingerprint(frame *cbf.Frame) fingerprint {
+	h := cbf.PerceptualHash(frame, nil)
+	return fingerprint{
+		SHA256: cbf.ContentHash(frame),
+		PHash:  cbf.FormatHash(h),
+		hash:   h,
 	}
+}
 
-	err = c.Upsert(ctx, uuid.New().String(), vec, map[string]any{
+// framePayload returns payload of ingested frame which includes file info
+// and results of frame analysis
+func (c *Client) framePayload(absPath string, frame *cbf.Frame, fp fingerprint, method string) map[string]any {
+	payload := map[string]any{
 		"filename": filepath.Base(absPath),
 		"path":     absPath,
-		"width":    int(w),
-		"height":   int(h),
-		"method":   eurl,
+		"width":    frame.Width,
+		"height":   frame.Height,
+		"method":   method,
 		"engine":   "cbf2go",
-	})
+		"sha256":   fp.SHA256,
+		"phash":    fp.PHash,
+		// bands are lookup keys of near-duplicate search
+		"phash_bands": cbf.HashBands(fp.hash, phashBands),
+	}
+	if frame.Meta.Detector != "" {
+		payload["detector"] = frame.Meta.Detector
+	}
+	if c.Background != "" && c.Background != cbf.BackgroundNone {
+		payload["background"] = string(c.Background)
+	}
 
-	return err
-}
+	// sweep membership is derived from file name template
+	if template, num, ok := sweep.ParseName(absPath); ok {
+		payload["sweep_id"] = sweep.ID(filepath.Dir(absPath), template)
+		payload["sweep_template"] = template
+		payload["frame_index"] = num
+	}
+
+	mask := frame.DefaultMask()
+	spots := cbf.FindSpots(frame, mask, cbf.DefaultSpotParams())
+	payload["n_spots"] = len(spots)
+	// resolution is stored only for diffracting frames, zero means no diffraction
+	if res, err := cbf.EstimateResolution(frame, spots, cbf.DefaultResolutionParams()); err != nil {
+		if c.Verbose > 0 {
+			fmt.Printf("unable to estimate resolution of %s: %v\n", absPath, err)
+		}
+	} else if res > 0 {
+		payload["resolution"] = res
+	}
 
-func (c *Client) IngestOne(ctx context.Context, path string, vectorSize int, eurl string) error {
-	if strings.HasPrefix(eurl, "http://") || strings.HasPrefix(eurl, "https://") {
-		return c.IngestViaEmbedClient(ctx, path, vectorSize, eurl)
+	// ice rings require detector geometry from the frame header
+	ice, err := cbf.DetectIceRings(frame, mask, cbf.DefaultIceParams())
+	if err == nil {
+		payload["ice_rings"] = ice.Iced
+		payload["ice_score"] = ice.Score
+		payload["ice_ring_count"] = ice.NRings
+	} else if c.Verbose > 0 {
+		fmt.Printf("unable to detect ice rings in %s: %v\n", absPath, err)
 	}
-	return c.IngestOneViaImageEmbedding(ctx, path, vectorSize)
+	return payload
 }
 
-func (c *Client) IngestOneViaImageEmbedding(ctx context.Context, path string, vectorSize int) error {
-
-	absPath, err := filepath.Abs(path)
-	if err != nil {
+// BatchIngest ingests files under given path with pool of workers, files
+// are enumerated according to Walk options while ingestion is running.
+// The whole batch must be ingested within timeoutLimit seconds plus one
+// second per file and worker, zero timeoutLimit means 60 seconds. Single
+// files are limited by FileTimeout. Failed files are handled according to
+// ErrorPolicy and returned as *BatchError.
+func (c *Client) BatchIngest(path string, workers int, timeoutLimit int) error {
+	t0 := time.Now()
+	if err := c.checkEmbedder(); err != nil {
 		return err
 	}
+	fmt.Printf("Ingesting %s via '%s' method\n", path, c.Embedder.Name())
 
-	filename := filepath.Base(absPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	exists, err := c.imageAlreadyInCollection(ctx, filename)
+	// all points of a collection must be embedded with the same method
+	method, err := c.CollectionMethod(ctx)
 	if err != nil {
 		return err
 	}
-	if exists {
-		fmt.Println("skipping (already ingested):", filename)
-		return nil
+	if method != "" && method != c.Embedder.Name() {
+		return fmt.Errorf("collection %s is embedded with '%s' method, not '%s'", c.Collection, method, c.Embedder.Name())
+	}
+	if c.Clip != nil {
+		method, err := c.Clip.CollectionMethod(ctx)
+		if err != nil {
+			return err
+		}
+		if method != "" && method != c.Clip.Embedder.Name() {
+			return fmt.Errorf("collection %s is embedded with '%s' method, not '%s'", c.Clip.Collection, method, c.Clip.Embedder.Name())
+		}
 	}
 
-	pixels, w, h, err := cbf.ReadCBF(path, c.Verbose)
+	// frames of concurrent workers are embedded in batches if embedder
+	// sends several frames per request
+	limit, err := embed.BatchLimit(ctx, c.Embedder)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to negotiate embedding batch size: %w", err)
+	}
+	if size := max(workers, 1); limit != 1 {
+		if limit > 0 {
+			size = min(size, limit)
+		}
+		if size > 1 {
+			if c.Verbose > 0 {
+				fmt.Printf("embedding frames in batches of %d\n", size)
+			}
+			c.batcher = embed.NewBatcher(ctx, c.Embedder, size, embed.DefaultBatchLinger)
+			defer func() {
+				c.batcher.Close()
+				c.batcher = nil
+			}()
+		}
 	}
 
-	vec := embed.ImageToEmbedding(pixels, w, h, vectorSize, c.Verbose)
-	if c.Verbose > 0 {
-		fmt.Printf("ImageToEmbedding return vector size: %d, width=%d height=%d\n", len(vec), w, h)
+	// outcome of every file is recorded in the manifest
+	if c.Manifest != nil {
+		c.tracker = newIngestTracker(c.Manifest, c.Resume)
+		if c.Clip != nil {
+			c.Clip.tracker = c.tracker
+		}
+		defer func() {
+			c.tracker = nil
+			if c.Clip != nil {
+				c.Clip.tracker = nil
+			}
+		}()
 	}
 
-	// Ensure collection exists before upsert
-	if err := c.ensureCollection(ctx, len(vec)); err != nil {
-		fmt.Printf("failed to create collection: %v\n", err)
-		return err
+	// failed files are collected and ingestion is stopped according to
+	// error policy
+	failures := newFailureCollector(c.ErrorPolicy, cancel)
+
+	// points are upserted in batches, failed batches are reported back to
+	// their files
+	if c.UpsertParams.BatchSize > 0 {
+		done := func(file string, err error) {
+			c.tracker.done(file, err)
+			if err != nil {
+				failures.add(file, ingestError(ErrorUpsert, err))
+			}
+		}
+		c.upserter = c.NewUpserter(c.UpsertParams, done)
+		if c.Clip != nil {
+			c.Clip.upserter = c.Clip.NewUpserter(c.UpsertParams, done)
+		}
 	}
 
-	err = c.Upsert(ctx, uuid.New().String(), vec, map[string]any{
-		"filename": filepath.Base(absPath),
-		"path":     absPath,
-		"width":    int(w),
-		"height":   int(h),
-		"method":   "image2embedding",
-		"engine":   "cbf2go",
+	// time budget of the batch grows with number of enumerated files
+	if timeoutLimit == 0 {
+		timeoutLimit = 60
+	}
+	deadline := newBatchDeadline(time.Duration(timeoutLimit)*time.Second, func() {
+		failures.stop(fmt.Sprintf("batch timeout of %ds plus 1s per file and worker exceeded", timeoutLimit))
 	})
-	return err
-}
+	defer deadline.stop()
 
-func (c *Client) BatchIngest(path string, workers int, vectorSize, timeoutLimit int, eurl string) error {
-	t0 := time.Now()
-	files, err := GetFilesFromPath(path)
-	if err != nil {
-		return err
+	files, walkErr := c.walkFiles(ctx, path)
+	c.ingestFiles(ctx, files, workers, deadline, failures)
+	// drain files left after cancellation, so walker can finish
+	for range files {
 	}
-	if eurl == "" {
-		fmt.Printf("Ingesting %d files via default image embedding method\n", len(files))
-	} else {
-		fmt.Printf("Ingesting %d files via '%s' method\n", len(files), eurl)
+	werr := <-walkErr
+	c.flushUpserts()
+	if n := c.tracker.unconfirmed(); n > 0 {
+		fmt.Printf("Upserts of %d files are not confirmed, files are recorded as %s and retried on resume\n", n, StatusQueued)
 	}
 
-	// set dynamic timeout interval based on number of processing files and nworkers
-	timeoutSec := len(files)/workers + 60 // +60s buffer
-	if timeoutLimit != 0 {
-		timeoutSec = len(files)/workers + timeoutLimit
+	report := failures.result()
+	if c.tracker != nil && c.Resume {
+		fmt.Printf("Skipped %d files completed according to manifest %s\n", c.tracker.resumed.Load(), c.Manifest.Path)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec)*time.Second)
-	defer cancel()
-
-	// to ensure collection creation we need to call once IngestOne API
-	if len(files) > 0 {
-		f := files[0]
-		if err := c.IngestOne(ctx, f, vectorSize, eurl); err != nil {
-			return err
+	fmt.Printf("Batch insgestion completed %d files in %v\n", report.Files, time.Since(t0))
+	if c.ErrorReport != "" {
+		if err := report.WriteReport(c.ErrorReport); err != nil {
+			fmt.Printf("unable to write error report %s: %v\n", c.ErrorReport, err)
 		}
-	} else {
+	}
+
+	switch {
+	case werr != nil && report.Stopped == "":
+		return werr
+	case report.Files == 0 && werr == nil:
 		return errors.New("no files found")
+	case len(report.Failures) > 0 || report.Stopped != "":
+		return report
+	}
+	return nil
+}
+
+// flushUpserts flushes and stops upsert pipelines of batch ingestion
+func (c *Client) flushUpserts() {
+	for _, cl := range []*Client{c, c.Clip} {
+		if cl != nil && cl.upserter != nil {
+			cl.upserter.Close()
+			cl.upserter = nil
+		}
 	}
-	// resize files array to use less than one file
-	if len(files) == 1 {
-		// if only one file was provided we are done
+}
+
+// walkFiles enumerates files of given path in background and reports
+// sweeps of every visited directory. Channel of files is closed when walk
+// is finished, its error is sent afterwards.
+func (c *Client) walkFiles(ctx context.Context, path string) (<-chan string, <-chan error) {
+	opts := c.Walk
+	if len(opts.Include) == 0 {
+		opts.Include = []string{"*." + c.FileExtension}
+	}
+	files := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(files)
+
+		// files of a directory are visited together, sweeps are tracked
+		// per directory by frame number ranges without keeping paths
+		var dir string
+		sweeps := sweep.NewTracker()
+		report := func() {
+			for _, s := range sweeps.Sweeps() {
+				if len(s.Gaps) > 0 || len(s.Duplicates) > 0 || c.Verbose > 0 {
+					fmt.Printf("sweep %s %s: %d frames [%d-%d], gaps %v, duplicates %v\n",
+						s.ID, filepath.Join(s.Dir, s.Template), s.Frames, s.First, s.Last, s.Gaps, s.Duplicates)
+				}
+			}
+			sweeps.Reset()
+		}
+		err := walk.Walk(ctx, path, opts, func(f string) error {
+			if d := filepath.Dir(f); d != dir {
+				report()
+				dir = d
+			}
+			sweeps.Add(f)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case files <- f:
+				return nil
+			}
+		})
+		report()
+		errc <- err
+	}()
+	return files, errc
+}
+
+// ingestOne ingests single file within FileTimeout, files completed
+// according to the manifest are skipped on resume
+func (c *Client) ingestOne(ctx context.Context, path string) error {
+	if c.tracker.completed(path) {
+		if c.Verbose > 0 {
+			fmt.Println("skipping (completed in manifest):", path)
+		}
 		return nil
 	}
-	files = files[1:]
+	fmt.Println("inserting", path)
+	fctx := ctx
+	if c.FileTimeout > 0 {
+		var cancel context.CancelFunc
+		fctx, cancel = context.WithTimeout(ctx, c.FileTimeout)
+		defer cancel()
+	}
+	err := c.IngestOne(fctx, path)
+	if err != nil && ctx.Err() != nil {
+		// batch ingestion was stopped while file was processed
+		err = ingestError(ErrorCanceled, err)
+	}
+	if err != nil {
+		c.tracker.failed(path, err)
+	}
+	return err
+}
 
-	jobs := make(chan string)
-	errs := make(chan error, len(files)) // buffered for all files
+// ingestFiles ingests files with pool of workers, deadline is extended by
+// one second per file and worker. Failed files are passed to failure
+// collector which stops ingestion according to error policy.
+func (c *Client) ingestFiles(ctx context.Context, files <-chan string, workers int, deadline *batchDeadline, failures *failureCollector) {
+	workers = max(workers, 1)
 	var wg sync.WaitGroup
-
-	// Start worker goroutines
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for f := range jobs {
-				if strings.HasSuffix(f, c.FileExtension) {
-					fmt.Println("inserting", f)
-				} else {
-					fmt.Println("skipping", f)
-					continue
-				}
-				if err := c.IngestOne(ctx, f, vectorSize, eurl); err != nil {
-					// send error and cancel context to stop all workers
-					errs <- fmt.Errorf("file %s: %w", f, err)
-					cancel()
+			for f := range files {
+				if ctx.Err() != nil {
 					return
 				}
+				deadline.extend(time.Second / time.Duration(workers))
+				failures.processed()
+				if err := c.ingestOne(ctx, f); err != nil {
+					failures.add(f, err)
+				}
 			}
 		}()
 	}
+	wg.Wait()
+}
 
-	// Send jobs
-	for _, f := range files {
-		select {
-		case <-ctx.Done():
-			break
-		case jobs <- f:
-		}
-	}
-	close(jobs)
+// batchDeadline calls expire function when time budget of batch ingestion
+// is exceeded, budget may be extended until then
+type batchDeadline struct {
+	mu    sync.Mutex
+	end   time.Time
+	timer *time.Timer
+}
 
-	// Wait for all workers to finish
-	wg.Wait()
-	close(errs)
+// newBatchDeadline returns deadline of given budget from now
+func newBatchDeadline(budget time.Duration, expire func()) *batchDeadline {
+	return &batchDeadline{end: time.Now().Add(budget), timer: time.AfterFunc(budget, expire)}
+}
 
-	// Collect first error if any
-	var firstErr error
-	for err := range errs {
-		if firstErr == nil {
-			firstErr = err
-		}
+// extend moves deadline by given duration unless it is already expired
+func (d *batchDeadline) extend(by time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer.Stop() {
+		d.end = d.end.Add(by)
+		d.timer.Reset(time.Until(d.end))
 	}
+}
 
-	fmt.Printf("Batch insgestion completed %d files in %v\n", len(files), time.Since(t0))
-	return firstErr
+// stop stops deadline timer
+func (d *batchDeadline) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timer.Stop()
 }
 
-func (c *Client) imageAlreadyInCollection(ctx context.Context, filename string) (bool, error) {
-	if !c.CollectionCreated {
-		// for first image when collection is not created we should return false
+// imageAlreadyInCollection checks if point of the frame with the same
+// content (SHA-256 of binary section) is already ingested, point with
+// different content is overwritten. If SkipDuplicates is set frames with
+// the same content ingested under other point IDs are considered as
+// ingested too. If SkipNearDuplicates is set frames which perceptual hash
+// is within NearDuplicateDistance are considered as ingested as well,
+// candidates sharing a hash band are verified by Hamming distance.
+func (c *Client) imageAlreadyInCollection(ctx context.Context, id string, fp fingerprint) (bool, error) {
+	exists, err := c.collectionExists(ctx)
+	if err != nil || !exists {
+		return false, err
+	}
+	points, err := c.QdrantClient.GetPointsClient().Get(ctx, &qdrant.GetPoints{
+		CollectionName: c.Collection,
+		Ids:            []*qdrant.PointId{qdrant.NewIDUUID(id)},
+		WithPayload:    qdrant.NewWithPayloadInclude("sha256"),
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, p := range points.GetResult() {
+		if p.Payload["sha256"].GetStringValue() == fp.SHA256 {
+			return true, nil
+		}
+	}
+	if !c.SkipDuplicates && !c.SkipNearDuplicates {
 		return false, nil
 	}
-	limit := uint32(1)
 
+	var should []*qdrant.Condition
+	limit := uint32(1)
+	if c.SkipDuplicates {
+		should = append(should, qdrant.NewMatchKeyword("sha256", fp.SHA256))
+	}
+	if c.SkipNearDuplicates {
+		should = append(should, qdrant.NewMatchKeywords("phash_bands", cbf.HashBands(fp.hash, phashBands)...))
+		limit = nearDuplicateCandidates
+	}
 	resp, err := c.QdrantClient.GetPointsClient().Scroll(ctx, &qdrant.ScrollPoints{
 		CollectionName: c.Collection,
 		Limit:          &limit,
-		WithPayload:    qdrant.NewWithPayload(true),
-		Filter: &qdrant.Filter{
-			Must: []*qdrant.Condition{
-				{
-					ConditionOneOf: &qdrant.Condition_Field{
-						Field: &qdrant.FieldCondition{
-							Key: "filename",
-							Match: &qdrant.Match{
-								MatchValue: &qdrant.Match_Keyword{
-									Keyword: filename,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+		WithPayload:    qdrant.NewWithPayloadInclude("sha256", "phash", "path"),
+		Filter:         &qdrant.Filter{Should: should},
 	})
 	if c.Verbose > 0 {
-		fmt.Printf("checking %s results %+v error=%v\n", filename, resp, err)
+		fmt.Printf("checking %s results %+v error=%v\n", fp.SHA256, resp, err)
 	}
 	if err != nil {
 		return false, err
 	}
 
-	return len(resp.Result) > 0, nil
+	for _, p := range resp.GetResult() {
+		if c.SkipDuplicates && p.Payload["sha256"].GetStringValue() == fp.SHA256 {
+			return true, nil
+		}
+		if !c.SkipNearDuplicates {
+			continue
+		}
+		h, err := cbf.ParseHash(p.Payload["phash"].GetStringValue())
+		if err != nil {
+			continue
+		}
+		if d := cbf.HammingDistance(fp.hash, h); d <= c.NearDuplicateDistance {
+			if c.Verbose > 0 {
+				fmt.Printf("near-duplicate of %s, distance %d\n", p.Payload["path"].GetStringValue(), d)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
 }
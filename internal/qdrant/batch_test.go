@@ -0,0 +1,41 @@
+package qdrant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchDeadline(t *testing.T) {
+	expired := make(chan time.Time, 1)
+	t0 := time.Now()
+	d := newBatchDeadline(20*time.Millisecond, func() { expired <- time.Now() })
+	defer d.stop()
+	for i := 0; i < 4; i++ {
+		d.extend(20 * time.Millisecond)
+	}
+	select {
+	case at := <-expired:
+		if el := at.Sub(t0); el < 100*time.Millisecond {
+			t.Errorf("deadline expired after %v, expected at least 100ms", el)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadline did not expire")
+	}
+	// expired deadline is not extended
+	d.extend(time.Hour)
+	if d.timer.Stop() {
+		t.Error("expired deadline was restarted")
+	}
+}
+
+func TestFailureCollectorStop(t *testing.T) {
+	canceled := 0
+	fc := newFailureCollector(DefaultErrorPolicy(), func() { canceled++ })
+	fc.stop("timeout")
+	fc.stop("other")
+	fc.add("a.cbf", ingestError(ErrorCanceled, nil))
+	report := fc.result()
+	if canceled != 1 || report.Stopped != "timeout" || len(report.Failures) != 0 {
+		t.Errorf("unexpected stopped ingestion: canceled %d, %+v", canceled, report)
+	}
+}
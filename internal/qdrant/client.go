@@ -1,11 +1,16 @@
 package qdrant
 
 import (
+	"cbf2go/internal/cbf"
 	"cbf2go/internal/embed"
+	"cbf2go/internal/walk"
 	"context"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	qdrant "github.com/qdrant/go-client/qdrant"
 )
@@ -16,8 +21,47 @@ type Client struct {
 	FileExtension     string
 	QdrantClient      *qdrant.Client
 	Verbose           int
-	EmbedClient       *embed.EmbedClient
+	Embedder          embed.Embedder
 	CollectionCreated bool
+	// skip frames which content is already ingested under other point ID,
+	// e.g. copies of a file when identity key is path
+	SkipDuplicates bool
+	// skip frames which perceptual hash is within NearDuplicateDistance of
+	// already ingested ones, distance is at most cbf.NearDuplicateDistance
+	SkipNearDuplicates    bool
+	NearDuplicateDistance int
+	// mask of shadowed pixels applied to every ingested frame, frames must
+	// have the same dimensions as the mask
+	Mask                  cbf.Mask
+	MaskWidth, MaskHeight int
+	// background estimation method, background is subtracted before embedding
+	Background cbf.BackgroundMethod
+	// client of CLIP collection populated at ingest time with the same point IDs
+	Clip *Client
+	// frame properties which determine point ID
+	Identity IdentityKey
+	// options of directory traversal of BatchIngest, files with FileExtension
+	// are included by default
+	Walk walk.Options
+	// parameters of batched upserts of BatchIngest
+	UpsertParams UpsertParams
+
+	// manifest of ingested files, if Resume is set files completed
+	// according to the manifest are skipped by BatchIngest
+	Manifest *Manifest
+	Resume   bool
+
+	// policy of failed files of BatchIngest and file of failure report,
+	// report is written as CSV if file has .csv extension and JSON otherwise
+	ErrorPolicy ErrorPolicy
+	ErrorReport string
+	// timeout of single file ingestion of BatchIngest, zero means no limit
+	FileTimeout time.Duration
+
+	collMu   sync.Mutex     // guards CollectionCreated
+	upserter *Upserter      // upsert pipeline of running batch ingestion
+	batcher  *embed.Batcher // embedding batcher of running batch ingestion
+	tracker  *ingestTracker // manifest writer of running batch ingestion
 }
 
 // ParseQdrantURL parses a URL like "http://localhost:6334" and returns host and port
@@ -64,6 +108,18 @@ func NewQdrantClient(qurl, col, fext string, verbose int) (*Client, error) {
 	}, nil
 }
 
+// WithCollection returns client of another collection which shares
+// connection and settings of this client
+func (c *Client) WithCollection(col string) *Client {
+	return &Client{
+		URL:           c.URL,
+		Collection:    col,
+		FileExtension: c.FileExtension,
+		QdrantClient:  c.QdrantClient,
+		Verbose:       c.Verbose,
+	}
+}
+
 func payloadToMap(p map[string]*qdrant.Value) map[string]any {
 	out := make(map[string]any, len(p))
 	for k, v := range p {
@@ -76,6 +132,12 @@ func payloadToMap(p map[string]*qdrant.Value) map[string]any {
 			out[k] = x.DoubleValue
 		case *qdrant.Value_BoolValue:
 			out[k] = x.BoolValue
+		case *qdrant.Value_ListValue:
+			values := make([]any, 0, len(x.ListValue.GetValues()))
+			for _, v := range x.ListValue.GetValues() {
+				values = append(values, payloadToMap(map[string]*qdrant.Value{"v": v})["v"])
+			}
+			out[k] = values
 		default:
 			out[k] = nil
 		}
@@ -95,29 +157,27 @@ func buildQdrantFilter(filter map[string]any) (*qdrant.Filter, error) {
 		key := f["key"].(string)
 
 		if match, ok := f["match"].(map[string]any); ok {
-			must = append(must,
-				qdrant.NewMatchKeyword(key, fmt.Sprint(match["value"])),
-			)
+			switch v := match["value"].(type) {
+			case bool:
+				must = append(must, qdrant.NewMatchBool(key, v))
+			case int:
+				must = append(must, qdrant.NewMatchInt(key, int64(v)))
+			case int64:
+				must = append(must, qdrant.NewMatchInt(key, v))
+			default:
+				must = append(must, qdrant.NewMatchKeyword(key, fmt.Sprint(v)))
+			}
 			continue
 		}
 
 		if rng, ok := f["range"].(map[string]any); ok {
-			r := &qdrant.Range{}
-			if gte, ok := rng["gte"]; ok {
-				switch v := gte.(type) {
-				case float64:
-					r.Gte = &v
-				}
-			}
-			if lte, ok := rng["lte"]; ok {
-				switch v := lte.(type) {
-				case float64:
-					r.Lte = &v
-				}
+			r := &qdrant.Range{
+				Gte: rangeValue(rng["gte"]),
+				Lte: rangeValue(rng["lte"]),
+				Gt:  rangeValue(rng["gt"]),
+				Lt:  rangeValue(rng["lt"]),
 			}
-			// TODO: I need to add my range to condition
-			cond := &qdrant.Condition{}
-			must = append(must, cond)
+			must = append(must, qdrant.NewRange(key, r))
 			continue
 		}
 
@@ -127,6 +187,52 @@ func buildQdrantFilter(filter map[string]any) (*qdrant.Filter, error) {
 	return &qdrant.Filter{Must: must}, nil
 }
 
+// rangeValue converts numeric range boundary to float64 pointer
+func rangeValue(v any) *float64 {
+	var f float64
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case float32:
+		f = float64(x)
+	case int:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	default:
+		return nil
+	}
+	return &f
+}
+
+// CollectionMethod returns embedding method stored in payload of collection
+// points, empty string is returned if collection does not exist or is empty.
+// Points ingested via embedding service by earlier versions store service
+// URL as method, it is reported as embed.MethodResNet.
+func (c *Client) CollectionMethod(ctx context.Context) (string, error) {
+	exists, err := c.QdrantClient.CollectionExists(ctx, c.Collection)
+	if err != nil || !exists {
+		return "", err
+	}
+	limit := uint32(1)
+	resp, err := c.QdrantClient.GetPointsClient().Scroll(ctx, &qdrant.ScrollPoints{
+		CollectionName: c.Collection,
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayloadInclude("method"),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range resp.GetResult() {
+		method := p.Payload["method"].GetStringValue()
+		if strings.Contains(method, "://") {
+			method = embed.MethodResNet
+		}
+		return method, nil
+	}
+	return "", nil
+}
+
 func (c *Client) Search(vec []float32, limit int) ([]map[string]any, error) {
 	ctx := context.Background()
 	pointsClient := c.QdrantClient.GetPointsClient()
@@ -200,6 +306,15 @@ func (c *Client) Upsert(
 	payload map[string]any,
 ) error {
 
+	point, err := newPoint(id, vec, payload)
+	if err != nil {
+		return err
+	}
+	return c.upsertPoints(ctx, []*qdrant.PointStruct{point}, true)
+}
+
+// newPoint converts vector and payload to qdrant point
+func newPoint(id string, vec []float32, payload map[string]any) (*qdrant.PointStruct, error) {
 	// Convert payload: map[string]any → map[string]*qdrant.Value
 	qPayload := make(map[string]*qdrant.Value, len(payload))
 	for k, v := range payload {
@@ -214,23 +329,31 @@ func (c *Client) Upsert(
 			qPayload[k] = qdrant.NewValueDouble(t)
 		case bool:
 			qPayload[k] = qdrant.NewValueBool(t)
+		case []string:
+			values := make([]*qdrant.Value, len(t))
+			for i, v := range t {
+				values[i] = qdrant.NewValueString(v)
+			}
+			qPayload[k] = qdrant.NewValueFromList(values...)
 		default:
-			return fmt.Errorf("unsupported payload type for key %q: %T", k, v)
+			return nil, fmt.Errorf("unsupported payload type for key %q: %T", k, v)
 		}
 	}
 
-	point := &qdrant.PointStruct{
+	return &qdrant.PointStruct{
 		Id:      qdrant.NewIDUUID(id),
 		Vectors: qdrant.NewVectors(vec...),
 		Payload: qPayload,
-	}
+	}, nil
+}
 
-	wait := true
+// upsertPoints upserts points in single request, if wait is set request
+// returns after points are applied
+func (c *Client) upsertPoints(ctx context.Context, points []*qdrant.PointStruct, wait bool) error {
 	_, err := c.QdrantClient.Upsert(ctx, &qdrant.UpsertPoints{
 		CollectionName: c.Collection,
-		Points:         []*qdrant.PointStruct{point},
+		Points:         points,
 		Wait:           &wait,
 	})
-
 	return err
 }
@@ -0,0 +1,226 @@
+package qdrant
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// error classes of failed files
+const (
+	ErrorRead       = "read"       // file can not be read or parsed
+	ErrorPreprocess = "preprocess" // mask or background subtraction failed
+	ErrorEmbed      = "embed"      // embedding service or method failed
+	ErrorQdrant     = "qdrant"     // collection lookup or creation failed
+	ErrorUpsert     = "upsert"     // points were not upserted
+	ErrorTimeout    = "timeout"    // file was not ingested within timeout
+	ErrorCanceled   = "canceled"   // ingestion was stopped
+	ErrorOther      = "other"
+)
+
+// IngestError represents error of a stage of file ingestion
+type IngestError struct {
+	Class string
+	Err   error
+}
+
+// Error implements error interface
+func (e *IngestError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+// Unwrap returns underlying error
+func (e *IngestError) Unwrap() error {
+	return e.Err
+}
+
+// ingestError wraps error with given class
+func ingestError(class string, err error) error {
+	return &IngestError{Class: class, Err: err}
+}
+
+// ErrorClass returns class of ingestion error
+func ErrorClass(err error) string {
+	var ierr *IngestError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &ierr):
+		return ierr.Class
+	}
+	return ErrorOther
+}
+
+// ErrorPolicy defines when batch ingestion stops on failed files
+type ErrorPolicy struct {
+	FailFast     bool    // stop on the first failed file
+	MaxErrors    int     // stop after given number of failed files, zero means no limit
+	MaxErrorRate float64 // stop when fraction of failed files exceeds given rate, zero means no limit
+	MinFiles     int     // number of processed files before error rate is checked
+}
+
+// DefaultErrorPolicy returns policy which ingests all files regardless of errors
+func DefaultErrorPolicy() ErrorPolicy {
+	return ErrorPolicy{MinFiles: 100}
+}
+
+// stop returns reason to stop ingestion with given number of failed and
+// processed files, empty string means ingestion continues
+func (p ErrorPolicy) stop(failed, processed int) string {
+	switch {
+	case p.FailFast:
+		return "fail-fast error policy"
+	case p.MaxErrors > 0 && failed >= p.MaxErrors:
+		return fmt.Sprintf("%d failed files reached error limit", failed)
+	case p.MaxErrorRate > 0 && processed >= p.MinFiles && float64(failed)/float64(processed) > p.MaxErrorRate:
+		return fmt.Sprintf("error rate %.3f of %d files exceeds %.3f", float64(failed)/float64(processed), processed, p.MaxErrorRate)
+	}
+	return ""
+}
+
+// Failure represents failed file of batch ingestion
+type Failure struct {
+	Path  string    `json:"path"`
+	Class string    `json:"class"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// BatchError represents failed files of batch ingestion
+type BatchError struct {
+	Files    int            `json:"files"`             // number of processed files
+	Failures []Failure      `json:"failures"`          // failed files in order of failure
+	Classes  map[string]int `json:"classes"`           // number of failed files per error class
+	Stopped  string         `json:"stopped,omitempty"` // reason ingestion was stopped before all files were processed
+}
+
+// Error implements error interface
+func (e *BatchError) Error() string {
+	msg := fmt.Sprintf("%d of %d files failed", len(e.Failures), e.Files)
+	classes := make([]string, 0, len(e.Classes))
+	for class, n := range e.Classes {
+		classes = append(classes, fmt.Sprintf("%s=%d", class, n))
+	}
+	sort.Strings(classes)
+	if len(classes) > 0 {
+		msg += " (" + strings.Join(classes, ", ") + ")"
+	}
+	if len(e.Failures) > 0 {
+		msg += fmt.Sprintf(", first: %s: %s", e.Failures[0].Path, e.Failures[0].Error)
+	}
+	if e.Stopped != "" {
+		msg += ", stopped: " + e.Stopped
+	}
+	return msg
+}
+
+// WriteReport writes failures to CSV file if path has .csv extension and
+// to JSON file otherwise
+func (e *BatchError) WriteReport(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		w := csv.NewWriter(file)
+		w.Write([]string{"path", "class", "error", "time"})
+		for _, f := range e.Failures {
+			w.Write([]string{f.Path, f.Class, f.Error, f.Time.Format(time.RFC3339)})
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(e)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// failureCollector collects failed files of batch ingestion and stops it
+// according to error policy
+type failureCollector struct {
+	policy ErrorPolicy
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	report BatchError
+	failed map[string]bool
+}
+
+// newFailureCollector returns collector which calls cancel to stop ingestion
+func newFailureCollector(policy ErrorPolicy, cancel context.CancelFunc) *failureCollector {
+	return &failureCollector{
+		policy: policy,
+		cancel: cancel,
+		report: BatchError{Failures: []Failure{}, Classes: make(map[string]int)},
+		failed: make(map[string]bool),
+	}
+}
+
+// processed counts file taken for ingestion
+func (fc *failureCollector) processed() {
+	fc.mu.Lock()
+	fc.report.Files++
+	fc.mu.Unlock()
+}
+
+// add records failed file, files canceled after ingestion is stopped are
+// not recorded
+func (fc *failureCollector) add(path string, err error) {
+	if abs, aerr := filepath.Abs(path); aerr == nil {
+		path = abs
+	}
+	class := ErrorClass(err)
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if (fc.report.Stopped != "" && class == ErrorCanceled) || fc.failed[path] {
+		return
+	}
+	fc.failed[path] = true
+	fc.report.Failures = append(fc.report.Failures, Failure{Path: path, Class: class, Error: err.Error(), Time: time.Now()})
+	fc.report.Classes[class]++
+	fmt.Printf("failed to ingest %s: %v\n", path, err)
+	if fc.report.Stopped != "" {
+		return
+	}
+	if reason := fc.policy.stop(len(fc.report.Failures), fc.report.Files); reason != "" {
+		fc.report.Stopped = reason
+		fmt.Println("stopping ingestion:", reason)
+		fc.cancel()
+	}
+}
+
+// stop stops ingestion with given reason unless it is already stopped
+func (fc *failureCollector) stop(reason string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.report.Stopped != "" {
+		return
+	}
+	fc.report.Stopped = reason
+	fmt.Println("stopping ingestion:", reason)
+	fc.cancel()
+}
+
+// result returns collected failures
+func (fc *failureCollector) result() *BatchError {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	report := fc.report
+	return &report
+}
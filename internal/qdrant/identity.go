@@ -0,0 +1,63 @@
+package qdrant
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdentityKey defines which frame properties determine its point ID
+type IdentityKey string
+
+// supported identity keys
+const (
+	IdentityContent   IdentityKey = "content"    // SHA-256 of CBF binary section
+	IdentityPath      IdentityKey = "path"       // absolute file path
+	IdentityPathMtime IdentityKey = "path+mtime" // absolute file path and modification time
+)
+
+// DefaultIdentity is used when identity key is not set
+var DefaultIdentity = IdentityContent
+
+// namespace of UUIDv5 point IDs
+var pointNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/vkuznet/cbf2go"))
+
+// ParseIdentityKey parses identity key name, empty name returns DefaultIdentity
+func ParseIdentityKey(s string) (IdentityKey, error) {
+	switch k := IdentityKey(s); k {
+	case "":
+		return DefaultIdentity, nil
+	case IdentityContent, IdentityPath, IdentityPathMtime:
+		return k, nil
+	}
+	return "", fmt.Errorf("unsupported identity key '%s', use %s, %s or %s", s, IdentityContent, IdentityPath, IdentityPathMtime)
+}
+
+// PointID returns deterministic point ID (UUIDv5) of given identity and
+// embedding method, so re-ingested frames overwrite their points
+func PointID(identity, method string) string {
+	return uuid.NewSHA1(pointNamespace, []byte(identity+"\x00"+method)).String()
+}
+
+// pointID returns point ID of frame with given absolute path and fingerprint
+func (c *Client) pointID(absPath string, fp fingerprint, method string) (string, error) {
+	key := c.Identity
+	if key == "" {
+		key = DefaultIdentity
+	}
+	switch key {
+	case IdentityContent:
+		return PointID("sha256:"+fp.SHA256, method), nil
+	case IdentityPath:
+		return PointID("path:"+absPath, method), nil
+	case IdentityPathMtime:
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return "", err
+		}
+		return PointID("path:"+absPath+"\x00mtime:"+info.ModTime().UTC().Format(time.RFC3339Nano), method), nil
+	}
+	return "", fmt.Errorf("unsupported identity key '%s'", key)
+}
@@ -0,0 +1,79 @@
+package qdrant
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseIdentityKey(t *testing.T) {
+	cases := map[string]IdentityKey{
+		"":           DefaultIdentity,
+		"content":    IdentityContent,
+		"path":       IdentityPath,
+		"path+mtime": IdentityPathMtime,
+	}
+	for s, want := range cases {
+		if k, err := ParseIdentityKey(s); err != nil || k != want {
+			t.Errorf("ParseIdentityKey(%q) = %q, %v, expected %q", s, k, err, want)
+		}
+	}
+	if _, err := ParseIdentityKey("mtime"); err == nil {
+		t.Error("expected error of unsupported identity key")
+	}
+}
+
+func TestPointID(t *testing.T) {
+	id := PointID("sha256:abc", "resnet")
+	if u, err := uuid.Parse(id); err != nil || u.Version() != 5 {
+		t.Fatalf("expected UUIDv5, got %s, %v", id, err)
+	}
+	if PointID("sha256:abc", "resnet") != id {
+		t.Error("point ID is not deterministic")
+	}
+	if PointID("sha256:abc", "clip") == id || PointID("sha256:abd", "resnet") == id {
+		t.Error("point ID does not depend on identity and method")
+	}
+}
+
+func TestClientPointID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a_00001.cbf")
+	if err := os.WriteFile(path, []byte("frame"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fp := fingerprint{SHA256: "abc"}
+	ids := make(map[IdentityKey]string)
+	for _, key := range []IdentityKey{IdentityContent, IdentityPath, IdentityPathMtime} {
+		c := &Client{Identity: key}
+		id, err := c.pointID(path, fp, "resnet")
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		ids[key] = id
+	}
+	if len(map[string]bool{ids[IdentityContent]: true, ids[IdentityPath]: true, ids[IdentityPathMtime]: true}) != 3 {
+		t.Errorf("identity keys give equal point IDs %v", ids)
+	}
+	if id, _ := (&Client{}).pointID(path, fp, "resnet"); id != ids[DefaultIdentity] {
+		t.Error("empty identity key does not use DefaultIdentity")
+	}
+
+	// content identity does not depend on path, path+mtime changes with mtime
+	c := &Client{Identity: IdentityContent}
+	if id, _ := c.pointID("/other/path.cbf", fp, "resnet"); id != ids[IdentityContent] {
+		t.Error("content point ID depends on path")
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	c = &Client{Identity: IdentityPathMtime}
+	if id, _ := c.pointID(path, fp, "resnet"); id == ids[IdentityPathMtime] {
+		t.Error("path+mtime point ID does not change with mtime")
+	}
+	if _, err := c.pointID(path+".missing", fp, "resnet"); err == nil {
+		t.Error("expected error of missing file")
+	}
+}
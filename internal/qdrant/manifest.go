@@ -0,0 +1,332 @@
+package qdrant
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileStatus represents ingestion status of a file
+type FileStatus string
+
+// ingestion statuses of manifest records
+const (
+	StatusIngested FileStatus = "ingested" // points are upserted
+	StatusQueued   FileStatus = "queued"   // points are sent but not confirmed as applied, file is retried on resume
+	StatusSkipped  FileStatus = "skipped"  // frame is already in the collection
+	StatusFailed   FileStatus = "failed"   // ingestion failed, file is retried on resume
+)
+
+// ManifestRecord represents ingestion outcome of a file
+type ManifestRecord struct {
+	Path   string     `json:"path"`
+	Size   int64      `json:"size"`
+	Mtime  time.Time  `json:"mtime"`
+	SHA256 string     `json:"sha256,omitempty"`
+	ID     string     `json:"id,omitempty"`
+	Status FileStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	Time   time.Time  `json:"time"`
+}
+
+// Manifest represents local log of ingested files. Records are appended as
+// JSON lines while ingestion runs, the latest record of a path wins, so
+// manifest of interrupted ingestion is valid and can be used to resume it.
+type Manifest struct {
+	Path string
+
+	mu      sync.Mutex
+	file    *os.File
+	records map[string]ManifestRecord
+}
+
+// ReadManifest reads manifest records, the latest record of every path is
+// returned. Incomplete lines of interrupted writes are ignored.
+func ReadManifest(path string) (map[string]ManifestRecord, error) {
+	records := make(map[string]ManifestRecord)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec ManifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Path == "" {
+			continue
+		}
+		records[rec.Path] = rec
+	}
+	return records, scanner.Err()
+}
+
+// OpenManifest opens manifest for writing. If resume is set existing
+// records are loaded and new ones are appended, otherwise manifest is
+// truncated.
+func OpenManifest(path string, resume bool) (*Manifest, error) {
+	m := &Manifest{Path: path, records: make(map[string]ManifestRecord)}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		records, err := ReadManifest(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if records != nil {
+			m.records = records
+		}
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	m.file = file
+	return m, nil
+}
+
+// Record appends record to the manifest
+func (m *Manifest) Record(rec ManifestRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[rec.Path] = rec
+	_, err = m.file.Write(append(data, '\n'))
+	return err
+}
+
+// Completed reports if file was ingested or skipped and is not modified since
+func (m *Manifest) Completed(path string) bool {
+	m.mu.Lock()
+	rec, ok := m.records[path]
+	m.mu.Unlock()
+	if !ok || (rec.Status != StatusIngested && rec.Status != StatusSkipped) {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Size() == rec.Size && info.ModTime().Equal(rec.Mtime)
+}
+
+// Close flushes manifest to disk and closes it
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.file.Sync(); err != nil {
+		m.file.Close()
+		return err
+	}
+	return m.file.Close()
+}
+
+// ManifestSummary represents summary of manifest records
+type ManifestSummary struct {
+	Files    int                `json:"files"`
+	Bytes    int64              `json:"bytes"`
+	Statuses map[FileStatus]int `json:"statuses"`
+	Errors   map[string]int     `json:"errors,omitempty"` // number of failed files per error message
+	First    time.Time          `json:"first"`
+	Last     time.Time          `json:"last"`
+}
+
+// Summarize returns summary of manifest records
+func Summarize(records map[string]ManifestRecord) ManifestSummary {
+	s := ManifestSummary{Statuses: make(map[FileStatus]int), Errors: make(map[string]int)}
+	for _, rec := range records {
+		s.Files++
+		s.Bytes += rec.Size
+		s.Statuses[rec.Status]++
+		if rec.Error != "" {
+			s.Errors[rec.Error]++
+		}
+		if s.First.IsZero() || rec.Time.Before(s.First) {
+			s.First = rec.Time
+		}
+		if rec.Time.After(s.Last) {
+			s.Last = rec.Time
+		}
+	}
+	return s
+}
+
+// SortedRecords returns records sorted by path
+func SortedRecords(records map[string]ManifestRecord) []ManifestRecord {
+	out := make([]ManifestRecord, 0, len(records))
+	for _, rec := range records {
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// ingestTracker writes manifest records of batch ingestion. Points of a
+// file may be upserted asynchronously, so file is recorded as ingested when
+// all its points are applied. Methods of nil tracker do nothing.
+type ingestTracker struct {
+	manifest *Manifest
+	resume   bool
+	resumed  atomic.Int64 // number of files skipped on resume
+
+	mu      sync.Mutex
+	pending map[string]*pendingFile
+}
+
+// pendingFile represents file with points queued for upsert
+type pendingFile struct {
+	rec       ManifestRecord
+	remaining int
+	err       error
+}
+
+// newIngestTracker returns tracker of given manifest
+func newIngestTracker(m *Manifest, resume bool) *ingestTracker {
+	return &ingestTracker{manifest: m, resume: resume, pending: make(map[string]*pendingFile)}
+}
+
+// newRecord returns manifest record of file
+func newRecord(path string) ManifestRecord {
+	rec := ManifestRecord{Path: path}
+	if info, err := os.Stat(path); err == nil {
+		rec.Size = info.Size()
+		rec.Mtime = info.ModTime()
+	}
+	return rec
+}
+
+// write appends record to the manifest
+func (t *ingestTracker) write(rec ManifestRecord) {
+	if err := t.manifest.Record(rec); err != nil {
+		fmt.Printf("failed to write manifest record of %s: %v\n", rec.Path, err)
+	}
+}
+
+// completed reports if file may be skipped on resume
+func (t *ingestTracker) completed(path string) bool {
+	if t == nil || !t.resume {
+		return false
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if !t.manifest.Completed(path) {
+		return false
+	}
+	t.resumed.Add(1)
+	return true
+}
+
+// expect registers file with n points queued for upsert
+func (t *ingestTracker) expect(path, sha, id string, n int) {
+	if t == nil {
+		return
+	}
+	rec := newRecord(path)
+	rec.SHA256 = sha
+	rec.ID = id
+	t.mu.Lock()
+	t.pending[path] = &pendingFile{rec: rec, remaining: n}
+	t.mu.Unlock()
+}
+
+// done records upsert outcome of a point of the file, nil error means that
+// point is applied
+func (t *ingestTracker) done(path string, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	p, ok := t.pending[path]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	p.remaining--
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	if p.remaining > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, path)
+	t.mu.Unlock()
+
+	rec := p.rec
+	rec.Status = StatusIngested
+	if p.err != nil {
+		rec.Status = StatusFailed
+		rec.Error = p.err.Error()
+	}
+	t.write(rec)
+}
+
+// skipped records file which frame is already in the collection
+func (t *ingestTracker) skipped(path, sha string) {
+	if t == nil {
+		return
+	}
+	rec := newRecord(path)
+	rec.SHA256 = sha
+	rec.Status = StatusSkipped
+	t.write(rec)
+}
+
+// failed records file which ingestion failed
+func (t *ingestTracker) failed(path string, err error) {
+	if t == nil {
+		return
+	}
+	if abs, aerr := filepath.Abs(path); aerr == nil {
+		path = abs
+	}
+	t.mu.Lock()
+	p, ok := t.pending[path]
+	delete(t.pending, path)
+	t.mu.Unlock()
+	rec := newRecord(path)
+	if ok {
+		rec = p.rec
+	}
+	rec.Status = StatusFailed
+	rec.Error = err.Error()
+	t.write(rec)
+}
+
+// unconfirmed records files which points are not confirmed as applied when
+// ingestion is finished as queued and returns their number
+func (t *ingestTracker) unconfirmed() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[string]*pendingFile)
+	t.mu.Unlock()
+	n := 0
+	for _, p := range pending {
+		rec := p.rec
+		rec.Status = StatusQueued
+		if p.err != nil {
+			rec.Status = StatusFailed
+			rec.Error = p.err.Error()
+		} else {
+			n++
+		}
+		t.write(rec)
+	}
+	return n
+}
@@ -0,0 +1,230 @@
+package qdrant
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+)
+
+// UpsertParams represents parameters of buffered upsert pipeline
+type UpsertParams struct {
+	BatchSize     int           // number of points per upsert request, zero disables pipeline
+	MaxBatchBytes int           // approximate size limit of upsert request
+	FlushInterval time.Duration // maximum time points are kept in buffer
+	Checkpoint    int           // every Checkpoint-th batch waits until points are applied, zero waits at final flush only
+	MaxInFlight   int           // number of concurrent upsert requests
+}
+
+// DefaultUpsertParams returns default parameters of upsert pipeline
+func DefaultUpsertParams() UpsertParams {
+	return UpsertParams{
+		BatchSize:     64,
+		MaxBatchBytes: 16 << 20,
+		FlushInterval: 2 * time.Second,
+		Checkpoint:    10,
+		MaxInFlight:   2,
+	}
+}
+
+// timeout of single upsert request of the pipeline
+var upsertTimeout = time.Minute
+
+// pendingPoint represents buffered point along with its source file
+type pendingPoint struct {
+	file  string
+	point *qdrant.PointStruct
+	size  int // approximate size of serialized point
+}
+
+// Upserter accumulates points from concurrent producers and upserts them to
+// collection in batches. Batches are sent without waiting for points to be
+// applied, except checkpoint batches and the final flush. Outcome of every
+// point is reported to done callback with its source file: failed points
+// are reported at once, points of batches sent without waiting are reported
+// when the next waiting batch succeeds. The callback is called from several
+// goroutines.
+type Upserter struct {
+	client   *Client
+	params   UpsertParams
+	done     func(file string, err error)
+	points   chan pendingPoint
+	finished chan struct{}
+	inflight sync.WaitGroup
+	sem      chan struct{}
+	nbatch   int            // number of flushed batches, used by run goroutine only
+	last     []pendingPoint // last batch sent without waiting, used by run goroutine only
+
+	mu     sync.Mutex
+	queued []pendingPoint // points sent without waiting which are not confirmed yet
+}
+
+// NewUpserter starts upsert pipeline of client collection, it must be
+// stopped by Close
+func (c *Client) NewUpserter(params UpsertParams, done func(file string, err error)) *Upserter {
+	if params.BatchSize < 1 {
+		params.BatchSize = 1
+	}
+	if params.MaxInFlight < 1 {
+		params.MaxInFlight = 1
+	}
+	u := &Upserter{
+		client:   c,
+		params:   params,
+		done:     done,
+		points:   make(chan pendingPoint, params.BatchSize),
+		finished: make(chan struct{}),
+		sem:      make(chan struct{}, params.MaxInFlight),
+	}
+	go u.run()
+	return u
+}
+
+// Add queues point of given file, it blocks while pipeline is busy
+func (u *Upserter) Add(ctx context.Context, file, id string, vec []float32, payload map[string]any) error {
+	point, err := newPoint(id, vec, payload)
+	if err != nil {
+		return err
+	}
+	size := 4*len(vec) + 64
+	for k, v := range payload {
+		size += len(k) + len(fmt.Sprint(v))
+	}
+	select {
+	case u.points <- pendingPoint{file: file, point: point, size: size}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes buffered points, waits for all requests to complete and
+// stops the pipeline, no points may be added afterwards
+func (u *Upserter) Close() {
+	close(u.points)
+	<-u.finished
+}
+
+// run collects points into batches until pipeline is closed
+func (u *Upserter) run() {
+	var tick <-chan time.Time
+	if u.params.FlushInterval > 0 {
+		ticker := time.NewTicker(u.params.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var batch []pendingPoint
+	size := 0
+	for {
+		select {
+		case p, ok := <-u.points:
+			if !ok {
+				u.flush(batch, true)
+				u.confirm()
+				u.inflight.Wait()
+				close(u.finished)
+				return
+			}
+			// large vectors may exceed request size limit before batch is full
+			if u.params.MaxBatchBytes > 0 && len(batch) > 0 && size+p.size > u.params.MaxBatchBytes {
+				u.flush(batch, false)
+				batch, size = nil, 0
+			}
+			batch = append(batch, p)
+			size += p.size
+			if len(batch) >= u.params.BatchSize {
+				u.flush(batch, false)
+				batch, size = nil, 0
+			}
+		case <-tick:
+			if len(batch) > 0 {
+				u.flush(batch, false)
+				batch, size = nil, 0
+			}
+		}
+	}
+}
+
+// flush sends batch of points. Checkpoint and final batches are sent after
+// all preceding requests complete and wait until points are applied, so
+// once they succeed all earlier points are persisted too.
+func (u *Upserter) flush(batch []pendingPoint, final bool) {
+	if len(batch) == 0 {
+		return
+	}
+	u.nbatch++
+	wait := final || (u.params.Checkpoint > 0 && u.nbatch%u.params.Checkpoint == 0)
+	if wait {
+		u.inflight.Wait()
+	}
+	u.sem <- struct{}{}
+	u.inflight.Add(1)
+	send := func() {
+		defer func() {
+			<-u.sem
+			u.inflight.Done()
+		}()
+		err := u.send(batch, wait)
+		u.sent(batch, wait, err)
+	}
+	if wait {
+		send()
+		return
+	}
+	u.last = batch
+	go send()
+}
+
+// send upserts batch of points
+func (u *Upserter) send(batch []pendingPoint, wait bool) error {
+	points := make([]*qdrant.PointStruct, len(batch))
+	for i, p := range batch {
+		points[i] = p.point
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), upsertTimeout)
+	defer cancel()
+	err := u.client.upsertPoints(ctx, points, wait)
+	if u.client.Verbose > 0 {
+		fmt.Printf("upsert of %d points to %s, wait=%v, error=%v\n", len(points), u.client.Collection, wait, err)
+	}
+	return err
+}
+
+// sent reports outcome of sent batch. Points of failed batch are reported
+// with its error, points of successful batch sent without waiting are
+// queued until a waiting batch succeeds, which confirms them as applied.
+func (u *Upserter) sent(batch []pendingPoint, wait bool, err error) {
+	u.mu.Lock()
+	var report []pendingPoint
+	switch {
+	case err != nil:
+		report = batch
+	case wait:
+		report = append(u.queued, batch...)
+		u.queued = nil
+	default:
+		u.queued = append(u.queued, batch...)
+	}
+	u.mu.Unlock()
+	for _, p := range report {
+		u.done(p.file, err)
+	}
+}
+
+// confirm waits until queued points are applied when final batch does not
+// confirm them, e.g. when it is empty or failed. The last batch sent without
+// waiting is repeated with wait, batches are applied in order so its success
+// confirms all queued points. Points which stay unconfirmed are not
+// reported.
+func (u *Upserter) confirm() {
+	u.inflight.Wait()
+	u.mu.Lock()
+	n := len(u.queued)
+	u.mu.Unlock()
+	if n == 0 || len(u.last) == 0 {
+		return
+	}
+	u.sent(nil, true, u.send(u.last, true))
+}
@@ -0,0 +1,139 @@
+package sweep
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cbf2go/internal/cbf"
+)
+
+// Frame represents single file of a sweep
+type Frame struct {
+	Path     string `json:"path"`
+	SweepID  string `json:"sweep_id"`
+	Template string `json:"template"`
+	Index    int    `json:"frame_index"` // frame counter from the file name
+}
+
+// Sweep represents rotation sweep, i.e. set of files which share file name
+// template, e.g. prot_1_#####.cbf for prot_1_00001.cbf, prot_1_00002.cbf, ...
+type Sweep struct {
+	ID         string   `json:"id"`
+	Dir        string   `json:"dir"`
+	Template   string   `json:"template"`
+	Frames     []Frame  `json:"frames"`
+	First      int      `json:"first"`
+	Last       int      `json:"last"`
+	Gaps       [][2]int `json:"gaps,omitempty"`         // ranges of missing frame numbers
+	OutOfOrder []int    `json:"out_of_order,omitempty"` // frames given out of counter order or with decreasing start angle
+	Warnings   []string `json:"warnings,omitempty"`     // header continuity problems
+}
+
+// file name pattern: prefix, zero padded counter and extension
+var namePattern = regexp.MustCompile(`^(.*?)(\d+)(\.[^.\d]*)?$`)
+
+// ParseName splits file name into sweep template and frame counter, e.g.
+// prot_1_00001.cbf is converted to prot_1_#####.cbf and 1
+func ParseName(path string) (string, int, bool) {
+	name := filepath.Base(path)
+	m := namePattern.FindStringSubmatch(name)
+	if m == nil {
+		return name, 0, false
+	}
+	num, err := strconv.Atoi(m[2])
+	if err != nil {
+		return name, 0, false
+	}
+	return m[1] + strings.Repeat("#", len(m[2])) + m[3], num, true
+}
+
+// ID returns sweep identifier for given directory and template
+func ID(dir, template string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	sum := sha1.Sum([]byte(filepath.Join(dir, template)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Group groups files into sweeps by directory and file name template. Files
+// without frame counter form single frame sweeps. Frames of every sweep are
+// sorted by counter, gaps and frames given out of counter order are recorded.
+func Group(paths []string) []*Sweep {
+	sweeps := make(map[string]*Sweep)
+	var order []string
+	for _, path := range paths {
+		template, num, _ := ParseName(path)
+		dir := filepath.Dir(path)
+		key := filepath.Join(dir, template)
+		s, ok := sweeps[key]
+		if !ok {
+			s = &Sweep{ID: ID(dir, template), Dir: dir, Template: template}
+			sweeps[key] = s
+			order = append(order, key)
+		}
+		if n := len(s.Frames); n > 0 && num < s.Frames[n-1].Index {
+			s.OutOfOrder = append(s.OutOfOrder, num)
+		}
+		s.Frames = append(s.Frames, Frame{Path: path, SweepID: s.ID, Template: template, Index: num})
+	}
+
+	out := make([]*Sweep, 0, len(order))
+	for _, key := range order {
+		s := sweeps[key]
+		sort.SliceStable(s.Frames, func(i, j int) bool { return s.Frames[i].Index < s.Frames[j].Index })
+		s.First = s.Frames[0].Index
+		s.Last = s.Frames[len(s.Frames)-1].Index
+		for i := 1; i < len(s.Frames); i++ {
+			prev, cur := s.Frames[i-1].Index, s.Frames[i].Index
+			if cur-prev > 1 {
+				s.Gaps = append(s.Gaps, [2]int{prev + 1, cur - 1})
+			}
+			if cur == prev {
+				s.Warnings = append(s.Warnings, fmt.Sprintf("duplicate frame %d", cur))
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// CheckHeaders reads headers of sweep frames and checks that start angle of
+// every frame continues the angle range of the previous one (within given
+// tolerance in degrees). Frames with decreasing start angle are reported as
+// out of order, other discontinuities are reported as warnings.
+func (s *Sweep) CheckHeaders(tolerance float64) error {
+	var prev *cbf.Frame
+	prevIdx := 0
+	for _, fr := range s.Frames {
+		hdr, err := cbf.ReadHeader(fr.Path)
+		if err != nil {
+			return fmt.Errorf("file %s: %w", fr.Path, err)
+		}
+		if prev != nil {
+			// account for missing frames between consecutive files
+			step := float64(fr.Index - prevIdx)
+			expect := prev.Meta.StartAngle + step*prev.Meta.AngleIncrement
+			switch {
+			case hdr.Meta.StartAngle < prev.Meta.StartAngle:
+				s.OutOfOrder = append(s.OutOfOrder, fr.Index)
+			case math.Abs(hdr.Meta.StartAngle-expect) > tolerance:
+				s.Warnings = append(s.Warnings, fmt.Sprintf(
+					"frame %d: start angle %.4f, expected %.4f", fr.Index, hdr.Meta.StartAngle, expect))
+			}
+			if hdr.Meta.AngleIncrement != prev.Meta.AngleIncrement {
+				s.Warnings = append(s.Warnings, fmt.Sprintf(
+					"frame %d: angle increment %.4f differs from %.4f", fr.Index, hdr.Meta.AngleIncrement, prev.Meta.AngleIncrement))
+			}
+		}
+		prev, prevIdx = hdr, fr.Index
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package sweep
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Summary represents sweep collected by Tracker, frames are counted but
+// their paths are not kept
+type Summary struct {
+	ID         string   `json:"id"`
+	Dir        string   `json:"dir"`
+	Template   string   `json:"template"`
+	Frames     int      `json:"frames"`
+	First      int      `json:"first"`
+	Last       int      `json:"last"`
+	Gaps       [][2]int `json:"gaps,omitempty"`       // ranges of missing frame numbers
+	Duplicates []int    `json:"duplicates,omitempty"` // frame numbers seen more than once
+}
+
+// Tracker collects sweeps of files added one by one in any order. Frame
+// numbers of every sweep are kept as sorted ranges, so memory depends on
+// number of gaps rather than number of files.
+type Tracker struct {
+	sweeps map[string]*tracked
+	order  []string
+}
+
+// tracked represents sweep state of Tracker
+type tracked struct {
+	summary Summary
+	ranges  [][2]int // sorted disjoint ranges of seen frame numbers
+}
+
+// NewTracker returns empty sweep tracker
+func NewTracker() *Tracker {
+	return &Tracker{sweeps: make(map[string]*tracked)}
+}
+
+// Add adds file to its sweep
+func (t *Tracker) Add(path string) {
+	template, num, _ := ParseName(path)
+	dir := filepath.Dir(path)
+	key := filepath.Join(dir, template)
+	s, ok := t.sweeps[key]
+	if !ok {
+		s = &tracked{summary: Summary{ID: ID(dir, template), Dir: dir, Template: template}}
+		t.sweeps[key] = s
+		t.order = append(t.order, key)
+	}
+	s.summary.Frames++
+	if !s.add(num) {
+		s.summary.Duplicates = append(s.summary.Duplicates, num)
+	}
+}
+
+// Sweeps returns summaries of tracked sweeps in order of their first file
+func (t *Tracker) Sweeps() []Summary {
+	out := make([]Summary, 0, len(t.order))
+	for _, key := range t.order {
+		s := t.sweeps[key]
+		sum := s.summary
+		sum.First = s.ranges[0][0]
+		sum.Last = s.ranges[len(s.ranges)-1][1]
+		for i := 1; i < len(s.ranges); i++ {
+			sum.Gaps = append(sum.Gaps, [2]int{s.ranges[i-1][1] + 1, s.ranges[i][0] - 1})
+		}
+		out = append(out, sum)
+	}
+	return out
+}
+
+// Reset removes all tracked sweeps
+func (t *Tracker) Reset() {
+	clear(t.sweeps)
+	t.order = t.order[:0]
+}
+
+// add adds frame number to sweep ranges, merging adjacent ranges, and
+// reports false if number was already seen
+func (s *tracked) add(num int) bool {
+	// first range which ends at or after num-1, i.e. may contain or touch num
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i][1] >= num-1 })
+	switch {
+	case i < len(s.ranges) && s.ranges[i][0] <= num && num <= s.ranges[i][1]:
+		return false
+	case i < len(s.ranges) && s.ranges[i][1] == num-1:
+		s.ranges[i][1] = num
+		// join with next range if the gap is closed
+		if i+1 < len(s.ranges) && s.ranges[i+1][0] == num+1 {
+			s.ranges[i][1] = s.ranges[i+1][1]
+			s.ranges = append(s.ranges[:i+1], s.ranges[i+2:]...)
+		}
+	case i < len(s.ranges) && s.ranges[i][0] == num+1:
+		s.ranges[i][0] = num
+	default:
+		s.ranges = append(s.ranges, [2]int{})
+		copy(s.ranges[i+1:], s.ranges[i:])
+		s.ranges[i] = [2]int{num, num}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package sweep
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	var paths []string
+	for i := 1; i <= 20; i++ {
+		if i == 5 || (i >= 10 && i <= 12) {
+			continue
+		}
+		paths = append(paths, fmt.Sprintf("/data/run1/prot_1_%05d.cbf", i))
+	}
+	paths = append(paths, "/data/run1/prot_1_00007.cbf", "/data/run1/dark.cbf", "/data/run2/prot_1_00003.cbf")
+
+	tr := NewTracker()
+	for _, i := range rand.New(rand.NewSource(1)).Perm(len(paths)) {
+		tr.Add(paths[i])
+	}
+	sweeps := tr.Sweeps()
+	if len(sweeps) != 3 {
+		t.Fatalf("expected 3 sweeps, got %+v", sweeps)
+	}
+	var run1 Summary
+	for _, s := range sweeps {
+		if s.Dir == "/data/run1" && s.Template == "prot_1_#####.cbf" {
+			run1 = s
+		}
+	}
+	want := Summary{
+		ID:         ID("/data/run1", "prot_1_#####.cbf"),
+		Dir:        "/data/run1",
+		Template:   "prot_1_#####.cbf",
+		Frames:     17,
+		First:      1,
+		Last:       20,
+		Gaps:       [][2]int{{5, 5}, {10, 12}},
+		Duplicates: []int{7},
+	}
+	if !reflect.DeepEqual(run1, want) {
+		t.Errorf("got %+v, expected %+v", run1, want)
+	}
+
+	tr.Reset()
+	if len(tr.Sweeps()) != 0 {
+		t.Error("tracker is not empty after reset")
+	}
+}
+
+func TestTrackerRanges(t *testing.T) {
+	// random insertion order merges ranges to a single one
+	for seed := int64(0); seed < 20; seed++ {
+		s := &tracked{}
+		for _, n := range rand.New(rand.NewSource(seed)).Perm(50) {
+			if !s.add(n) {
+				t.Fatalf("seed %d: %d reported as duplicate", seed, n)
+			}
+		}
+		if !reflect.DeepEqual(s.ranges, [][2]int{{0, 49}}) {
+			t.Fatalf("seed %d: unexpected ranges %v", seed, s.ranges)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy defines how symbolic links are treated
+type SymlinkPolicy string
+
+// supported symlink policies
+const (
+	SymlinkSkip   SymlinkPolicy = "skip"   // ignore symbolic links
+	SymlinkFiles  SymlinkPolicy = "files"  // follow links to files, skip links to directories
+	SymlinkFollow SymlinkPolicy = "follow" // follow links to files and directories
+)
+
+// ParseSymlinkPolicy parses symlink policy name, empty name returns SymlinkFiles
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return SymlinkFiles, nil
+	case SymlinkSkip, SymlinkFiles, SymlinkFollow:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported symlink policy '%s', use %s, %s or %s", s, SymlinkSkip, SymlinkFiles, SymlinkFollow)
+}
+
+// Options represents options of directory traversal. Patterns are globs of
+// filepath.Match syntax, "**" matches any number of directories. Pattern
+// without slash is matched against file or directory name, otherwise
+// against slash separated path relative to the root.
+type Options struct {
+	Recursive bool          // descend into subdirectories
+	MaxDepth  int           // maximum depth of visited subdirectories, zero means no limit
+	Include   []string      // patterns of files to visit, empty list includes all files
+	Exclude   []string      // patterns of excluded files and directories
+	Symlinks  SymlinkPolicy // symbolic link policy, empty value means SymlinkFiles
+	Hidden    bool          // visit hidden files and directories (names starting with dot)
+}
+
+// number of directory entries read at once
+var dirChunk = 1024
+
+// SkipDir may be returned by callback to skip remaining files of current
+// directory and its subdirectories
+var SkipDir = fs.SkipDir
+
+// Walk calls fn for every regular file under root matching options. Files
+// of a directory are visited in directory order (not sorted) before its
+// subdirectories. Directory entries are read in chunks, so only a chunk of
+// entries and names of pending subdirectories are kept in memory. If root
+// is a file fn is called for it regardless of patterns.
+func Walk(ctx context.Context, root string, opts Options, fn func(path string) error) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("failed to stat path %q: %w", root, err)
+	}
+	if !info.IsDir() {
+		return fn(root)
+	}
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	w := &walker{ctx: ctx, root: root, opts: opts, fn: fn, visited: make(map[string]bool)}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		w.visited[real] = true
+	}
+	err = w.walk(root, 0)
+	if errors.Is(err, SkipDir) {
+		return nil
+	}
+	return err
+}
+
+// Files returns all files under root matching options in order of Walk
+func Files(root string, opts Options) ([]string, error) {
+	var files []string
+	err := Walk(context.Background(), root, opts, func(path string) error {
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// walker represents state of directory traversal
+type walker struct {
+	ctx     context.Context
+	root    string
+	opts    Options
+	fn      func(path string) error
+	visited map[string]bool // resolved directories reached via symlinks, used to break loops
+}
+
+// walk visits files and subdirectories of dir at given depth
+func (w *walker) walk(dir string, depth int) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+	subdirs, err := w.files(f, depth)
+	f.Close()
+	if err != nil {
+		if errors.Is(err, SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	for _, sub := range subdirs {
+		if err := w.walk(sub, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files visits files of open directory at given depth chunk by chunk and
+// returns its subdirectories to descend into
+func (w *walker) files(f *os.File, depth int) ([]string, error) {
+	dir := f.Name()
+	var subdirs []string
+	for {
+		entries, rerr := f.ReadDir(dirChunk)
+		for _, entry := range entries {
+			if err := w.ctx.Err(); err != nil {
+				return nil, err
+			}
+			sub, err := w.entry(dir, entry, depth)
+			if err != nil {
+				return nil, err
+			}
+			if sub != "" {
+				subdirs = append(subdirs, sub)
+			}
+		}
+		if rerr == io.EOF {
+			return subdirs, nil
+		}
+		if rerr != nil {
+			return nil, fmt.Errorf("failed to read directory %q: %w", dir, rerr)
+		}
+	}
+}
+
+// entry visits directory entry if it is a matching file and returns its
+// path if it is a subdirectory to descend into
+func (w *walker) entry(dir string, entry fs.DirEntry, depth int) (string, error) {
+	name := entry.Name()
+	if !w.opts.Hidden && strings.HasPrefix(name, ".") {
+		return "", nil
+	}
+	full := filepath.Join(dir, name)
+	rel := w.rel(full)
+	if matchAny(w.opts.Exclude, name, rel) {
+		return "", nil
+	}
+	mode := entry.Type()
+	if mode&fs.ModeSymlink != 0 {
+		if w.opts.Symlinks == SymlinkSkip {
+			return "", nil
+		}
+		info, err := os.Stat(full)
+		if err != nil {
+			// dangling link
+			return "", nil
+		}
+		mode = info.Mode().Type()
+		if mode.IsDir() && w.opts.Symlinks != SymlinkFollow {
+			return "", nil
+		}
+		if mode.IsDir() {
+			real, err := filepath.EvalSymlinks(full)
+			if err != nil || w.visited[real] {
+				return "", nil
+			}
+			w.visited[real] = true
+		}
+	}
+	switch {
+	case mode.IsDir():
+		if w.opts.Recursive && (w.opts.MaxDepth <= 0 || depth < w.opts.MaxDepth) {
+			return full, nil
+		}
+	case mode.IsRegular():
+		if len(w.opts.Include) > 0 && !matchAny(w.opts.Include, name, rel) {
+			return "", nil
+		}
+		return "", w.fn(full)
+	}
+	return "", nil
+}
+
+// rel returns slash separated path relative to the root
+func (w *walker) rel(full string) string {
+	rel, err := filepath.Rel(w.root, full)
+	if err != nil {
+		return filepath.ToSlash(full)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// matchAny reports if any pattern matches name or relative path
+func matchAny(patterns []string, name, rel string) bool {
+	for _, p := range patterns {
+		if Match(p, name, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports if pattern matches file with given name and slash separated
+// path relative to walk root, see Options
+func Match(pattern, name, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments, "**" segment matches zero or more
+// segments
+func matchSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pattern[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -0,0 +1,155 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, name, rel string
+		match              bool
+	}{
+		{"*.cbf", "a_00001.cbf", "run1/a_00001.cbf", true},
+		{"*.cbf", "a_00001.img", "a_00001.img", false},
+		{"run1/*.cbf", "a.cbf", "run1/a.cbf", true},
+		{"run1/*.cbf", "a.cbf", "run2/a.cbf", false},
+		{"run1/*.cbf", "a.cbf", "x/run1/a.cbf", false},
+		{"**/*.cbf", "a.cbf", "a.cbf", true},
+		{"**/*.cbf", "a.cbf", "x/y/z/a.cbf", true},
+		{"**/sweep_*/*.cbf", "a.cbf", "x/sweep_1/a.cbf", true},
+		{"**/sweep_*/*.cbf", "a.cbf", "x/sweep_1/y/a.cbf", false},
+		{"run1/**", "a.cbf", "run1/x/a.cbf", true},
+		{"/run1/*.cbf", "a.cbf", "run1/a.cbf", true},
+		{"[", "a.cbf", "a.cbf", false},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.name, c.rel); got != c.match {
+			t.Errorf("Match(%q, %q, %q) = %v, expected %v", c.pattern, c.name, c.rel, got, c.match)
+		}
+	}
+}
+
+// touch creates empty files under root
+func touch(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relFiles returns sorted paths relative to root
+func relFiles(t *testing.T, root string, files []string) []string {
+	t.Helper()
+	out := make([]string, len(files))
+	for i, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = filepath.ToSlash(rel)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestWalk(t *testing.T) {
+	// read directories in several chunks
+	chunk := dirChunk
+	dirChunk = 2
+	defer func() { dirChunk = chunk }()
+
+	root := t.TempDir()
+	touch(t, root, "a_1.cbf", "a_2.cbf", "a_3.cbf", "notes.txt", ".hidden.cbf",
+		"run1/b_1.cbf", "run1/b_2.cbf", "run1/deep/c_1.cbf", "skip/d_1.cbf")
+	if err := os.Symlink(filepath.Join(root, "a_1.cbf"), filepath.Join(root, "link.cbf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "run1", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"flat", Options{Include: []string{"*.cbf"}},
+			[]string{"a_1.cbf", "a_2.cbf", "a_3.cbf", "link.cbf"}},
+		{"recursive", Options{Recursive: true, Include: []string{"*.cbf"}, Exclude: []string{"skip"}},
+			[]string{"a_1.cbf", "a_2.cbf", "a_3.cbf", "link.cbf", "run1/b_1.cbf", "run1/b_2.cbf", "run1/deep/c_1.cbf"}},
+		{"depth", Options{Recursive: true, MaxDepth: 1, Include: []string{"run1/*"}},
+			[]string{"run1/b_1.cbf", "run1/b_2.cbf"}},
+		{"hidden without links", Options{Hidden: true, Symlinks: SymlinkSkip, Include: []string{"*.cbf"}},
+			[]string{".hidden.cbf", "a_1.cbf", "a_2.cbf", "a_3.cbf"}},
+		{"follow", Options{Recursive: true, Symlinks: SymlinkFollow, Include: []string{"**/b_*.cbf"}},
+			[]string{"run1/b_1.cbf", "run1/b_2.cbf"}},
+	}
+	for _, c := range cases {
+		files, err := Files(root, c.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := relFiles(t, root, files); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, expected %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "sub/x.cbf", "a.cbf", "b.cbf")
+	files, err := Files(root, Options{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files of a directory are visited before its subdirectories
+	if len(files) != 3 || filepath.Base(files[2]) != "x.cbf" {
+		t.Errorf("unexpected order %v", files)
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "a.cbf", "b.cbf", "sub/c.cbf")
+	n := 0
+	err := Walk(context.Background(), root, Options{Recursive: true}, func(path string) error {
+		n++
+		return SkipDir
+	})
+	if err != nil || n != 1 {
+		t.Errorf("expected walk to stop after the first file, got %d files, %v", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Walk(ctx, root, Options{}, func(string) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled walk, got %v", err)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	root := t.TempDir()
+	if _, err := Files(filepath.Join(root, "missing"), Options{}); err == nil {
+		t.Error("expected error of missing root")
+	}
+	if _, err := Files(root, Options{Include: []string{"["}}); err == nil {
+		t.Error("expected error of invalid pattern")
+	}
+	touch(t, root, "a.cbf")
+	files, err := Files(filepath.Join(root, "a.cbf"), Options{Include: []string{"*.img"}})
+	if err != nil || len(files) != 1 {
+		t.Errorf("expected root file regardless of patterns, got %v, %v", files, err)
+	}
+}